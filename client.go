@@ -2,12 +2,16 @@ package lifx
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"reflect"
 	"sync"
 	"time"
+
+	"github.com/wolfeidau/lifx/protocol"
 )
 
 const (
@@ -17,6 +21,15 @@ const (
 	// PeerPort port used for peer to peer messages to lifx globes
 	PeerPort = 56750
 
+	// MaxLabelLen the maximum length in bytes of bulb and tag labels
+	MaxLabelLen = 32
+
+	// how often known bulbs are polled for the position of their reset switch
+	resetSwitchPollInterval = 5 * time.Second
+
+	// how long a gateway can go without answering discovery before it is dropped
+	gatewayExpiry = 10 * time.Second
+
 	bulbOff uint16 = 0
 	bulbOn  uint16 = 1
 )
@@ -26,14 +39,26 @@ var emptyAddr = [6]byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
 // StateHandler this is called when there is a change in the state of a bulb
 type StateHandler func(newState *BulbState)
 
-// Bulb Holds the state for a lifx bulb
+// Bulb Holds the state for a lifx bulb, it is updated by discovery so read it via the getters
 type Bulb struct {
-	LifxAddress  [6]byte // incoming messages are desimanated by lifx address
-	bulbState    *BulbState
+	LifxAddress  [6]byte    // incoming messages are desimanated by lifx address
+	bulbState    *BulbState // replaced rather than changed so each snapshot stays consistent
 	stateHandler StateHandler
 
+	hardware     HardwareInfo // populated once the bulb answers GetVersion
+	meshFirmware FirmwareInfo // refreshed each time the bulb is discovered
+	wifiFirmware FirmwareInfo // refreshed each time the bulb is discovered
+	mesh         MeshInfo     // link quality to the mesh, refreshed during discovery
+	info         DeviceInfo   // populated each time the bulb answers GetInfo
+
 	lastLightState *lightStateCommand
 	lastSeen       time.Time
+	label          string
+	tags           uint64
+	gatewayAddress string // host address of the gateway which last reported the bulb
+	resetSwitch    ResetSwitch
+
+	mutex sync.RWMutex // mutex for locking the state of the bulb
 }
 
 func newBulb(lifxAddress [6]byte) *Bulb {
@@ -42,6 +67,9 @@ func newBulb(lifxAddress [6]byte) *Bulb {
 
 // GetState Get a *snapshot* of the state for the bulb
 func (b *Bulb) GetState() BulbState {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
 	return *b.bulbState
 }
 
@@ -52,17 +80,66 @@ func (b *Bulb) GetLifxAddress() string {
 
 // GetPower Is the globe powered on or off
 func (b *Bulb) GetPower() uint16 {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
 	return b.bulbState.Power
 }
 
 // GetLabel Get the label from the globe
 func (b *Bulb) GetLabel() string {
-	return string(bytes.Trim(b.lastLightState.Payload.BulbLabel[:], "\x00"))
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.label
 }
 
 // GetTags returns the tags identifier for the bulb.
 func (b *Bulb) GetTags() uint64 {
-	return b.lastLightState.Payload.Tags
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.tags
+}
+
+// GetHardware returns the vendor, product and hardware version of the bulb, populated once it answers GetVersion
+func (b *Bulb) GetHardware() HardwareInfo {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.hardware
+}
+
+// GetMeshFirmware returns the firmware of the bulbs mesh subsystem, refreshed each time it is discovered
+func (b *Bulb) GetMeshFirmware() FirmwareInfo {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.meshFirmware
+}
+
+// GetWifiFirmware returns the firmware of the bulbs wifi subsystem, refreshed each time it is discovered
+func (b *Bulb) GetWifiFirmware() FirmwareInfo {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.wifiFirmware
+}
+
+// GetMesh returns the link quality between the bulb and the mesh, refreshed during discovery
+func (b *Bulb) GetMesh() MeshInfo {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.mesh
+}
+
+// GetInfo returns the clock and power history of the bulb, populated each time it answers GetInfo
+func (b *Bulb) GetInfo() DeviceInfo {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.info
 }
 
 // String is primarily for the fmt package to properly print instances of *Bulb
@@ -73,25 +150,94 @@ func (b *Bulb) String() string {
 // SetStateHandler add a handler which is invoked each time a state change comes through
 func (b *Bulb) SetStateHandler(handler StateHandler) {
 	//log.Printf("bulb %s", b)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
 	b.stateHandler = handler
 }
 
-func (b *Bulb) update(bulb *Bulb) bool {
+func (b *Bulb) getGatewayAddress() string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.gatewayAddress
+}
+
+// returns the change to the state, or nil if there wasn't one
+func (b *Bulb) update(bulb *Bulb) *BulbStateChanged {
+	b.mutex.Lock()
+
 	if bulb.bulbState.Visible {
 		b.lastSeen = time.Now()
 	}
 
+	b.lastLightState = bulb.lastLightState
+	b.label = bulb.label
+	b.tags = bulb.tags
+	b.gatewayAddress = bulb.gatewayAddress
+
 	if !reflect.DeepEqual(b.bulbState, bulb.bulbState) {
+		change := &BulbStateChanged{Bulb: b, New: *bulb.bulbState}
+
+		if b.bulbState != nil {
+			change.Old = *b.bulbState
+		}
+
 		// update the state
 		b.bulbState = bulb.bulbState
 
-		if b.stateHandler != nil {
-			b.stateHandler(b.bulbState)
+		handler, state := b.stateHandler, b.bulbState
+		b.mutex.Unlock()
+
+		// invoked without the lock so the handler can read the bulb
+		if handler != nil {
+			handler(state)
 		}
 
-		return true
+		return change
+	}
+
+	b.mutex.Unlock()
+	return nil
+}
+
+// replace the state with a changed copy, the handler is invoked if it differs,
+// returns the change to the state or nil if there wasn't one
+func (b *Bulb) changeState(change func(state *BulbState)) *BulbStateChanged {
+	b.mutex.Lock()
+
+	if b.bulbState == nil {
+		b.mutex.Unlock()
+		return nil
+	}
+
+	old := *b.bulbState
+
+	state := old
+	change(&state)
+
+	if state == old {
+		b.mutex.Unlock()
+		return nil
+	}
+
+	b.bulbState = &state
+
+	handler := b.stateHandler
+	b.mutex.Unlock()
+
+	if handler != nil {
+		handler(&state)
+	}
+
+	return &BulbStateChanged{b, old, state}
+}
+
+// let subscribers know the state changed, if it did
+func (c *Client) notifyStateChanged(change *BulbStateChanged) {
+	if change != nil {
+		c.notifySubs(change)
 	}
-	return false
 }
 
 // BulbState a snapshot of the bulbs last state
@@ -117,17 +263,183 @@ func newBulbState(hue, saturation, brightness, kelvin, dim, power uint16, visibl
 	}
 }
 
-// LightSensorState a snapshot of the bulbs ambient light sensor read
-type LightSensorState struct {
+// HardwareInfo identifies the model of a bulb
+type HardwareInfo struct {
+	Vendor  uint32
+	Product uint32
+	Version uint32
+}
+
+// FirmwareInfo the firmware running on one of the bulbs subsystems
+type FirmwareInfo struct {
+	Build time.Time
+	Major uint16
+	Minor uint16
+}
+
+func newFirmwareInfo(build uint64, version uint32) FirmwareInfo {
+	return FirmwareInfo{
+		Build: time.Unix(0, int64(build)),
+		Major: uint16(version >> 16),
+		Minor: uint16(version),
+	}
+}
+
+// String formats the firmware version as major.minor
+func (f FirmwareInfo) String() string {
+	return fmt.Sprintf("%d.%d", f.Major, f.Minor)
+}
+
+// Waveform the shape of the transition used by a waveform effect
+type Waveform uint8
+
+const (
+	// WaveformSaw ramps to the colour then snaps back
+	WaveformSaw Waveform = iota
+	// WaveformSine smoothly oscillates to the colour and back
+	WaveformSine
+	// WaveformHalfSine smoothly rises to the colour then snaps back
+	WaveformHalfSine
+	// WaveformTriangle linearly oscillates to the colour and back
+	WaveformTriangle
+	// WaveformPulse switches between the colours, SkewRatio sets the duty cycle
+	WaveformPulse
+)
+
+// WaveformOptions describes a waveform effect run on the bulb itself
+type WaveformOptions struct {
+	Waveform   Waveform
+	Transient  bool // return to the original colour once the cycles complete
+	Hue        uint16
+	Saturation uint16
+	Brightness uint16
+	Kelvin     uint16
+	Period     uint32  // duration of a cycle in milliseconds
+	Cycles     float32 // number of cycles to run
+	SkewRatio  int16   // shifts the peak of each cycle, 0 is the middle
+}
+
+func newSetWaveformFromOptions(opts WaveformOptions) (*setWaveformCommand, error) {
+	if opts.Waveform > WaveformPulse {
+		return nil, fmt.Errorf("unknown waveform %d", opts.Waveform)
+	}
+
+	return newSetWaveformCommand(opts.Transient, opts.Hue, opts.Saturation, opts.Brightness, opts.Kelvin, opts.Period, opts.Cycles, opts.SkewRatio, uint8(opts.Waveform)), nil
+}
+
+// DeviceInfo the clock and power history of a bulb
+type DeviceInfo struct {
+	Time     time.Time
+	Uptime   time.Duration
+	Downtime time.Duration // how long the bulb was off before it last powered on
+}
+
+// BulbRebooted is emitted to subscribers when a bulbs uptime goes backwards between calls to GetInfo
+type BulbRebooted struct {
+	Bulb           *Bulb
+	PreviousUptime time.Duration
+	Uptime         time.Duration
+}
+
+// RebootOptions confirms which bulb Client.Reboot is allowed to restart
+type RebootOptions struct {
+	// Confirm must match the lifx address of the bulb, as returned by Bulb.GetLifxAddress
+	Confirm string
+}
+
+// McuRailVoltage a reading of the MCU supply rail of a bulb
+type McuRailVoltage struct {
+	lifxAddress [6]byte // the bulb which took the reading
+	Voltage     uint32  // as reported by the bulb
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which we queried for rail voltage
+func (m *McuRailVoltage) GetLifxAddress() string {
+	return fmt.Sprintf("%x", m.lifxAddress)
+}
+
+// ResetSwitch the position of the physical reset switch on a bulb
+type ResetSwitch uint8
+
+const (
+	// ResetSwitchUp the switch is released
+	ResetSwitchUp ResetSwitch = iota
+	// ResetSwitchDown the switch is pressed, holding it will factory reset the bulb
+	ResetSwitchDown
+)
+
+func (r ResetSwitch) String() string {
+	switch r {
+	case ResetSwitchUp:
+		return "Up"
+	case ResetSwitchDown:
+		return "Down"
+	}
+	return fmt.Sprintf("ResetSwitch(%d)", uint8(r))
+}
+
+// ResetSwitchState is emitted to subscribers when the reset switch of a bulb changes position
+type ResetSwitchState struct {
+	lifxAddress [6]byte // the bulb whose switch moved
+	Position    ResetSwitch
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb whose reset switch changed
+func (r *ResetSwitchState) GetLifxAddress() string {
+	return fmt.Sprintf("%x", r.lifxAddress)
+}
+
+// RawPacket a packet the client has no decoder for, delivered to subscribers of SubscribeRaw
+type RawPacket struct {
+	Header  *Header
+	Payload []byte
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which sent the packet
+func (r *RawPacket) GetLifxAddress() string {
+	return fmt.Sprintf("%x", r.Header.TargetMacAddress)
+}
+
+// MeshInfo the link quality between a bulb and the mesh
+type MeshInfo struct {
+	Signal         float32 // received signal strength in mW
+	Tx             uint32  // bytes transmitted since power on
+	Rx             uint32  // bytes received since power on
+	McuTemperature int16
+}
+
+// GatewayTopology a gateway and the bulbs which last reported through it
+type GatewayTopology struct {
+	Gateway *Gateway
+	Bulbs   []*Bulb
+}
+
+// SensorReading a snapshot of the bulbs ambient light sensor read
+type SensorReading struct {
 	lifxAddress [6]byte // incoming messages are desimanated by lifx address
 	Lux         float32
 }
 
+// LightSensorState is the previous name of SensorReading
+type LightSensorState = SensorReading
+
 // GetLifxAddress returns the unique lifx address of the bulb which we queried for light sensor state
-func (l *LightSensorState) GetLifxAddress() string {
+func (l *SensorReading) GetLifxAddress() string {
 	return fmt.Sprintf("%x", l.lifxAddress)
 }
 
+// TimeState a snapshot of a bulbs clock
+type TimeState struct {
+	lifxAddress [6]byte // the bulb which reported the time
+	Time        time.Time
+	Drift       time.Duration // how far the bulbs clock is ahead of ours when the reading arrived
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which we queried for the time
+func (t *TimeState) GetLifxAddress() string {
+	return fmt.Sprintf("%x", t.lifxAddress)
+}
+
 // Gateway Lifx bulb which is acting as a gateway to the mesh
 type Gateway struct {
 	lifxAddress [6]byte
@@ -135,6 +447,12 @@ type Gateway struct {
 	Port        uint16
 	Site        [6]byte // incoming messages are desimanated by site
 	lastSeen    time.Time
+
+	HeaderVersion HeaderVersion // the header layout the gateway answered with
+	socket        *net.UDPConn  // shared socket so unicast replies reach the client
+	source        uint32        // the source of the client which found the gateway
+
+	mutex sync.RWMutex // mutex for locking the socket and last seen
 }
 
 // GetLifxAddress returns the unique lifx address of the gateway
@@ -147,16 +465,22 @@ func (g *Gateway) GetSite() string {
 	return fmt.Sprintf("%x", g.Site)
 }
 
-func newGateway(lifxAddress [6]byte, hostAddress string, port uint16, site [6]byte) *Gateway {
+func newGateway(lifxAddress [6]byte, hostAddress string, port uint16, site [6]byte, version HeaderVersion) *Gateway {
 	return &Gateway{
-		lifxAddress: lifxAddress,
-		hostAddress: hostAddress,
-		Port:        port,
-		Site:        site,
+		lifxAddress:   lifxAddress,
+		hostAddress:   hostAddress,
+		Port:          port,
+		Site:          site,
+		HeaderVersion: version,
 	}
 }
 
-func (g *Gateway) sendTo(cmd command) error {
+func (g *Gateway) sendTo(ctx context.Context, cmd command) error {
+	// don't start a send which is already abandoned
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// can we connect to the gw
 	addr, err := net.ResolveUDPAddr("udp4", g.hostAddress)
 
@@ -164,17 +488,45 @@ func (g *Gateway) sendTo(cmd command) error {
 		return err
 	}
 
+	cmd.SetHeaderVersion(g.HeaderVersion)
+
+	g.mutex.RLock()
+	shared := g.socket
+	g.mutex.RUnlock()
+
+	// devices speaking the frame header reply to the sender, so send from the listening socket,
+	// this is shared with other senders so the deadline of ctx is not applied to it
+	if shared != nil && g.HeaderVersion == FrameHeader {
+		buf := new(bytes.Buffer)
+
+		_, err = cmd.WriteTo(buf)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = shared.WriteTo(buf.Bytes(), addr)
+
+		return err
+	}
+
 	// open the connection, which we retain for all peer -> globe comms
-	socket, err := net.DialUDP("udp4", nil, addr)
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "udp4", addr.String())
 
 	if err != nil {
 		return err
 	}
 
-	defer socket.Close()
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
 
 	// send to globe
-	_, err = cmd.WriteTo(socket)
+	_, err = cmd.WriteTo(conn)
 
 	if err != nil {
 		return err
@@ -185,19 +537,30 @@ func (g *Gateway) sendTo(cmd command) error {
 	return nil
 }
 
-func (g *Gateway) findBulbs() error {
+func (g *Gateway) findBulbs(ctx context.Context) error {
 	// get Light State
 	lcmd := newGetLightStateCommand(g.Site)
+	lcmd.SetSource(g.source)
 
-	err := g.sendTo(lcmd)
+	err := g.sendTo(ctx, lcmd)
 
 	if err != nil {
 		return err
 	}
 
 	tcmd := newGetTagsCommand(g.Site)
+	tcmd.SetSource(g.source)
+
+	err = g.sendTo(ctx, tcmd)
+
+	if err != nil {
+		return err
+	}
+
+	mcmd := newGetMeshInfoCommand(g.Site)
+	mcmd.SetSource(g.source)
 
-	err = g.sendTo(tcmd)
+	err = g.sendTo(ctx, mcmd)
 
 	if err != nil {
 		return err
@@ -208,8 +571,9 @@ func (g *Gateway) findBulbs() error {
 
 // used to feed the event processor
 type cmdEvent struct {
-	addr net.Addr
-	cmd  interface{}
+	addr   net.Addr
+	header *Header
+	cmd    interface{}
 }
 
 // Client holds all the state and connections for the lifx client.
@@ -224,18 +588,73 @@ type Client struct {
 	discoTicker *time.Ticker
 	commandCh   chan *cmdEvent
 	subs        []*Sub
+	rawSubs     []*Sub
+
+	devicesMutex sync.RWMutex // mutex for locking the bulbs and gateways
+	subsMutex    sync.RWMutex // mutex for locking the subscribers
 
 	tags      map[uint64][]byte // the tags known to the client
 	tagsMutex sync.RWMutex      // mutex for locking the tags map
+
+	lastResetSwitchPoll time.Time
+
+	source   uint32 // identifies this client to devices speaking the frame header
+	sequence uint32 // the sequence of the last request, only the low byte is sent
+
+	RequestTimeout time.Duration // how long the synchronous calls wait for each reply
+	RequestRetries int           // how many times the synchronous calls resend a request
+
+	pending      []*pendingRequest // requests waiting on a reply
+	pendingMutex sync.Mutex        // mutex for locking the pending requests
+
+	stopDiscovery context.CancelFunc // cancels the running discovery, nil when stopped
+	discoMutex    sync.Mutex         // mutex serialising the start and stop of discovery
+	discoWg       sync.WaitGroup     // the goroutines of the running discovery
+
+	done       chan struct{} // closed by Close to abandon anything in flight
+	closed     bool
+	closeMutex sync.RWMutex // mutex for locking the closed flag
 }
 
 // NewClient make a new lifx client
 func NewClient() *Client {
-	return &Client{commandCh: make(chan *cmdEvent)}
+	return &Client{
+		commandCh:      make(chan *cmdEvent),
+		source:         newSource(),
+		RequestTimeout: DefaultRequestTimeout,
+		RequestRetries: DefaultRequestRetries,
+		done:           make(chan struct{}),
+	}
+}
+
+// a non zero source asks frame header devices to reply directly to us
+func newSource() uint32 {
+	for {
+		if source := rand.Uint32(); source != 0 {
+			return source
+		}
+	}
 }
 
 // StartDiscovery Begin searching for lifx globes on the local LAN
 func (c *Client) StartDiscovery() (err error) {
+	return c.StartDiscoveryCtx(context.Background())
+}
+
+// StartDiscoveryCtx is StartDiscovery bounded by ctx, once it is cancelled discovery
+// stops and the listening socket is closed, StopDiscovery must be called before starting again
+func (c *Client) StartDiscoveryCtx(ctx context.Context) (err error) {
+	c.discoMutex.Lock()
+	defer c.discoMutex.Unlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	if c.stopDiscovery != nil {
+		return fmt.Errorf("discovery has already started")
+	}
+
 	//log.Printf("Listening for bcast :%d", BroadcastPort)
 
 	// this socket will recieve broadcast packets on this socket
@@ -245,18 +664,31 @@ func (c *Client) StartDiscovery() (err error) {
 		return
 	}
 
+	ctx, c.stopDiscovery = context.WithCancel(ctx)
+
 	c.discoTicker = time.NewTicker(time.Second * 3)
 
-	// once you pop you can't stop
-	go c.startMainEventLoop()
+	c.discoWg.Add(2)
+
+	go func() {
+		defer c.discoWg.Done()
+
+		c.startMainEventLoop(ctx)
+	}()
 
-	// once you pop you can't stop
 	go func() {
+		defer c.discoWg.Done()
 
 		c.sendDiscovery(time.Now())
 
-		for t := range c.discoTicker.C {
-			c.sendDiscovery(t)
+		for {
+			select {
+			case t := <-c.discoTicker.C:
+				c.sendDiscovery(t)
+			case <-ctx.Done():
+				c.discoTicker.Stop()
+				return
+			}
 		}
 
 	}()
@@ -264,138 +696,863 @@ func (c *Client) StartDiscovery() (err error) {
 	return
 }
 
+// StopDiscovery stops searching for lifx globes, closing the listening socket and waiting
+// for the discovery goroutines to exit, known bulbs and gateways are kept
+func (c *Client) StopDiscovery() {
+	c.discoMutex.Lock()
+	defer c.discoMutex.Unlock()
+
+	if c.stopDiscovery == nil {
+		return
+	}
+
+	c.stopDiscovery()
+	c.discoWg.Wait()
+
+	// a packet being processed as discovery stopped may have handed the closed socket to a gateway
+	c.releaseSocket()
+
+	c.stopDiscovery = nil
+}
+
+// stop the known gateways sending from the listening socket
+func (c *Client) releaseSocket() {
+	for _, gw := range c.getGateways() {
+		gw.mutex.Lock()
+		gw.socket = nil
+		gw.mutex.Unlock()
+	}
+}
+
+// Close stops discovery and closes the channel of every subscriber, discarding any events
+// they have not read, once closed commands and queries return ErrClosed
+func (c *Client) Close() error {
+	c.closeMutex.Lock()
+
+	if c.closed {
+		c.closeMutex.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	close(c.done)
+
+	c.closeMutex.Unlock()
+
+	// closing the subscribers first frees discovery if it is held up by a blocking subscriber
+	c.subsMutex.Lock()
+	subs := append(c.subs, c.rawSubs...)
+	c.subs, c.rawSubs = nil, nil
+	c.subsMutex.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+
+	c.StopDiscovery()
+
+	return nil
+}
+
+func (c *Client) isClosed() bool {
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+
+	return c.closed
+}
+
 // LightsOn turn all lifx bulbs on
 func (c *Client) LightsOn() error {
+	return c.LightsOnCtx(context.Background())
+}
+
+// LightsOnCtx is LightsOn bounded by ctx
+func (c *Client) LightsOnCtx(ctx context.Context) error {
 	cmd := newSetPowerStateCommand(bulbOn)
 
-	return c.sendToAll(cmd)
+	return c.sendToAll(ctx, cmd)
 }
 
 // LightsOff turn all lifx bulbs off
 func (c *Client) LightsOff() error {
+	return c.LightsOffCtx(context.Background())
+}
+
+// LightsOffCtx is LightsOff bounded by ctx
+func (c *Client) LightsOffCtx(ctx context.Context) error {
 	cmd := newSetPowerStateCommand(bulbOff)
 
-	return c.sendToAll(cmd)
+	return c.sendToAll(ctx, cmd)
 }
 
 // LightsColour changes the color of all lifx bulbs
 func (c *Client) LightsColour(hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+	return c.LightsColourCtx(context.Background(), hue, sat, lum, kelvin, timing)
+}
+
+// LightsColourCtx is LightsColour bounded by ctx
+func (c *Client) LightsColourCtx(ctx context.Context, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
 	cmd := newSetLightColour(hue, sat, lum, kelvin, timing)
 
-	return c.sendToAll(cmd)
+	return c.sendToAll(ctx, cmd)
 }
 
-// LightOn turn on a bulb
-func (c *Client) LightOn(bulb *Bulb) error {
+// TagOn turn on all lifx bulbs carrying the tag
+func (c *Client) TagOn(tag uint64) error {
+	return c.TagOnCtx(context.Background(), tag)
+}
+
+// TagOnCtx is TagOn bounded by ctx
+func (c *Client) TagOnCtx(ctx context.Context, tag uint64) error {
 	cmd := newSetPowerStateCommand(bulbOn)
 
-	return c.sendTo(bulb, cmd)
+	return c.sendToTag(ctx, tag, cmd)
 }
 
-// LightOff turn off a bulb
-func (c *Client) LightOff(bulb *Bulb) error {
+// TagOff turn off all lifx bulbs carrying the tag
+func (c *Client) TagOff(tag uint64) error {
+	return c.TagOffCtx(context.Background(), tag)
+}
+
+// TagOffCtx is TagOff bounded by ctx
+func (c *Client) TagOffCtx(ctx context.Context, tag uint64) error {
 	cmd := newSetPowerStateCommand(bulbOff)
 
-	return c.sendTo(bulb, cmd)
+	return c.sendToTag(ctx, tag, cmd)
 }
 
-// LightColour change the color of a bulb
-func (c *Client) LightColour(bulb *Bulb, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+// TagColour changes the color of all lifx bulbs carrying the tag
+func (c *Client) TagColour(tag uint64, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+	return c.TagColourCtx(context.Background(), tag, hue, sat, lum, kelvin, timing)
+}
+
+// TagColourCtx is TagColour bounded by ctx
+func (c *Client) TagColourCtx(ctx context.Context, tag uint64, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
 	cmd := newSetLightColour(hue, sat, lum, kelvin, timing)
 
-	return c.sendTo(bulb, cmd)
+	return c.sendToTag(ctx, tag, cmd)
 }
 
-// GetBulbs get a list of the bulbs found by the client
-func (c *Client) GetBulbs() []*Bulb {
-	return c.bulbs
+// LightsWaveform runs a waveform effect on all lifx bulbs
+func (c *Client) LightsWaveform(opts WaveformOptions) error {
+	return c.LightsWaveformCtx(context.Background(), opts)
 }
 
-// GetBulbState send a notification to the bulb to emit it's current state
-func (c *Client) GetBulbState(bulb *Bulb) error {
-	//log.Printf("GetBulbState sent to %s", bulb.GetLifxAddress())
-	cmd := newGetLightStateCommandFromBulb(bulb.LifxAddress)
-	return c.sendTo(bulb, cmd)
-}
+// LightsWaveformCtx is LightsWaveform bounded by ctx
+func (c *Client) LightsWaveformCtx(ctx context.Context, opts WaveformOptions) error {
+	cmd, err := newSetWaveformFromOptions(opts)
 
-// GetAmbientLight send a notification to the bulb to emit the current ambient light
-func (c *Client) GetAmbientLight(bulb *Bulb) error {
-	//log.Printf("GetAmbientLight sent to %s", bulb.GetLifxAddress())
-	cmd := newGetAmbientLightCommandFromBulb(bulb.LifxAddress)
-	return c.sendTo(bulb, cmd)
-}
+	if err != nil {
+		return err
+	}
 
-// Subscribe listen for new bulbs or gateways, note this is a pointer to the actual value.
-func (c *Client) Subscribe() *Sub {
-	sub := newSub()
-	c.subs = append(c.subs, sub)
-	return sub
+	return c.sendToAll(ctx, cmd)
 }
 
-// Tags returns the known tags of the LIFX cluster.
-// This requires that StartDiscovery() has been ran and fnished
-//
-// The value returned is a map[uint64][]byte.
-// The uint64 value is the tag's ID, and the byte slice is the label
-func (c *Client) Tags() map[uint64][]byte {
-	// the tags map is a moving target
-	// so we need to make a copy to return
-	tags := make(map[uint64][]byte)
+// TagWaveform runs a waveform effect on all lifx bulbs carrying the tag
+func (c *Client) TagWaveform(tag uint64, opts WaveformOptions) error {
+	return c.TagWaveformCtx(context.Background(), tag, opts)
+}
 
-	// take the read lock and defer the unlock
-	c.tagsMutex.RLock()
-	defer c.tagsMutex.RUnlock()
+// TagWaveformCtx is TagWaveform bounded by ctx
+func (c *Client) TagWaveformCtx(ctx context.Context, tag uint64, opts WaveformOptions) error {
+	cmd, err := newSetWaveformFromOptions(opts)
 
-	// copy the c.tags map to the new one
-	for k, v := range c.tags {
-		tags[k] = v
+	if err != nil {
+		return err
 	}
 
-	return tags
+	return c.sendToTag(ctx, tag, cmd)
 }
 
-func (c *Client) sendTo(bulb *Bulb, cmd command) error {
-	cmd.SetLifxAddr(bulb.LifxAddress) // ensure the message is addressed to the correct bulb
+// SetWaveform runs a waveform effect on a bulb
+func (c *Client) SetWaveform(bulb *Bulb, opts WaveformOptions) error {
+	return c.SetWaveformCtx(context.Background(), bulb, opts)
+}
 
-	for _, gw := range c.gateways {
-		//log.Printf("sending command to %s", gw.hostAddress)
-		cmd.SetSiteAddr(gw.Site) // update the site address for each gateway
-		err := gw.sendTo(cmd)
-		if err != nil {
-			return err
-		}
+// SetWaveformCtx is SetWaveform bounded by ctx
+func (c *Client) SetWaveformCtx(ctx context.Context, bulb *Bulb, opts WaveformOptions) error {
+	cmd, err := newSetWaveformFromOptions(opts)
+
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return c.sendTo(ctx, bulb, cmd)
 }
 
-func (c *Client) sendToAll(cmd command) error {
-	for _, gw := range c.gateways {
+// LightsDim sets the dim level of all lifx bulbs leaving their colour unchanged
+func (c *Client) LightsDim(level uint16, timing uint32) error {
+	return c.LightsDimCtx(context.Background(), level, timing)
+}
+
+// LightsDimCtx is LightsDim bounded by ctx
+func (c *Client) LightsDimCtx(ctx context.Context, level uint16, timing uint32) error {
+	err := c.sendToAll(ctx, newSetDimAbsoluteCommand(level, timing))
+
+	if err != nil {
+		return err
+	}
+
+	for _, bulb := range c.GetBulbs() {
+		c.updateBulbDim(bulb, level)
+	}
+
+	return nil
+}
+
+// LightsAdjustDim moves the dim level of all lifx bulbs up or down by delta leaving their colour unchanged
+func (c *Client) LightsAdjustDim(delta int16, timing uint32) error {
+	return c.LightsAdjustDimCtx(context.Background(), delta, timing)
+}
+
+// LightsAdjustDimCtx is LightsAdjustDim bounded by ctx
+func (c *Client) LightsAdjustDimCtx(ctx context.Context, delta int16, timing uint32) error {
+	err := c.sendToAll(ctx, newSetDimRelativeCommand(delta, timing))
+
+	if err != nil {
+		return err
+	}
+
+	for _, bulb := range c.GetBulbs() {
+		c.adjustBulbDim(bulb, delta)
+	}
+
+	return nil
+}
+
+// SetDim sets the dim level of a bulb leaving it's colour unchanged
+func (c *Client) SetDim(bulb *Bulb, level uint16, timing uint32) error {
+	return c.SetDimCtx(context.Background(), bulb, level, timing)
+}
+
+// SetDimCtx is SetDim bounded by ctx
+func (c *Client) SetDimCtx(ctx context.Context, bulb *Bulb, level uint16, timing uint32) error {
+	err := c.sendTo(ctx, bulb, newSetDimAbsoluteCommand(level, timing))
+
+	if err != nil {
+		return err
+	}
+
+	c.updateBulbDim(bulb, level)
+
+	return nil
+}
+
+// AdjustDim moves the dim level of a bulb up or down by delta leaving it's colour unchanged
+func (c *Client) AdjustDim(bulb *Bulb, delta int16, timing uint32) error {
+	return c.AdjustDimCtx(context.Background(), bulb, delta, timing)
+}
+
+// AdjustDimCtx is AdjustDim bounded by ctx
+func (c *Client) AdjustDimCtx(ctx context.Context, bulb *Bulb, delta int16, timing uint32) error {
+	err := c.sendTo(ctx, bulb, newSetDimRelativeCommand(delta, timing))
+
+	if err != nil {
+		return err
+	}
+
+	c.adjustBulbDim(bulb, delta)
+
+	return nil
+}
+
+// LightOn turn on a bulb
+func (c *Client) LightOn(bulb *Bulb) error {
+	return c.LightOnCtx(context.Background(), bulb)
+}
+
+// LightOnCtx is LightOn bounded by ctx
+func (c *Client) LightOnCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newSetPowerStateCommand(bulbOn)
+
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// LightOff turn off a bulb
+func (c *Client) LightOff(bulb *Bulb) error {
+	return c.LightOffCtx(context.Background(), bulb)
+}
+
+// LightOffCtx is LightOff bounded by ctx
+func (c *Client) LightOffCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newSetPowerStateCommand(bulbOff)
+
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// LightColour change the color of a bulb
+func (c *Client) LightColour(bulb *Bulb, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+	return c.LightColourCtx(context.Background(), bulb, hue, sat, lum, kelvin, timing)
+}
+
+// LightColourCtx is LightColour bounded by ctx
+func (c *Client) LightColourCtx(ctx context.Context, bulb *Bulb, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+	cmd := newSetLightColour(hue, sat, lum, kelvin, timing)
+
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetBulbs get a list of the bulbs found by the client
+func (c *Client) GetBulbs() []*Bulb {
+	// the bulbs are a moving target so return a copy
+	c.devicesMutex.RLock()
+	defer c.devicesMutex.RUnlock()
+
+	return append([]*Bulb(nil), c.bulbs...)
+}
+
+// a copy of the gateways which is safe to range over while discovery runs
+func (c *Client) getGateways() []*Gateway {
+	c.devicesMutex.RLock()
+	defer c.devicesMutex.RUnlock()
+
+	return append([]*Gateway(nil), c.gateways...)
+}
+
+// GetBulbState send a notification to the bulb to emit it's current state
+func (c *Client) GetBulbState(bulb *Bulb) error {
+	return c.GetBulbStateCtx(context.Background(), bulb)
+}
+
+// GetBulbStateCtx is GetBulbState bounded by ctx
+func (c *Client) GetBulbStateCtx(ctx context.Context, bulb *Bulb) error {
+	//log.Printf("GetBulbState sent to %s", bulb.GetLifxAddress())
+	cmd := newGetLightStateCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetAmbientLight send a notification to the bulb to emit the current ambient light
+func (c *Client) GetAmbientLight(bulb *Bulb) error {
+	return c.GetAmbientLightCtx(context.Background(), bulb)
+}
+
+// GetAmbientLightCtx is GetAmbientLight bounded by ctx
+func (c *Client) GetAmbientLightCtx(ctx context.Context, bulb *Bulb) error {
+	//log.Printf("GetAmbientLight sent to %s", bulb.GetLifxAddress())
+	cmd := newGetAmbientLightCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetLabel send a notification to the bulb to emit it's label, subscribers are notified if it has changed
+func (c *Client) GetLabel(bulb *Bulb) error {
+	return c.GetLabelCtx(context.Background(), bulb)
+}
+
+// GetLabelCtx is GetLabel bounded by ctx
+func (c *Client) GetLabelCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetBulbLabelCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// SetLabel change the label of a bulb, this is limited to MaxLabelLen bytes
+func (c *Client) SetLabel(bulb *Bulb, name string) error {
+	return c.SetLabelCtx(context.Background(), bulb, name)
+}
+
+// SetLabelCtx is SetLabel bounded by ctx
+func (c *Client) SetLabelCtx(ctx context.Context, bulb *Bulb, name string) error {
+	label, err := encodeLabel(name)
+
+	if err != nil {
+		return err
+	}
+
+	cmd := newSetBulbLabelCommand(label)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetTime send a notification to the bulb to emit it's current time
+func (c *Client) GetTime(bulb *Bulb) error {
+	return c.GetTimeCtx(context.Background(), bulb)
+}
+
+// GetTimeCtx is GetTime bounded by ctx
+func (c *Client) GetTimeCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetTimeCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// SetTime set the clock of a bulb
+func (c *Client) SetTime(bulb *Bulb, t time.Time) error {
+	return c.SetTimeCtx(context.Background(), bulb, t)
+}
+
+// SetTimeCtx is SetTime bounded by ctx
+func (c *Client) SetTimeCtx(ctx context.Context, bulb *Bulb, t time.Time) error {
+	cmd := newSetTimeCommand(t)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetVersion send a notification to the bulb to emit it's vendor, product and hardware version,
+// once received these are available via Bulb.GetHardware and subscribers are notified with the bulb,
+// use GetVersionSync to wait for them
+func (c *Client) GetVersion(bulb *Bulb) error {
+	return c.GetVersionCtx(context.Background(), bulb)
+}
+
+// GetVersionCtx is GetVersion bounded by ctx
+func (c *Client) GetVersionCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetVersionCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetFirmware send a notification to the bulb to emit the firmware of it's mesh and wifi subsystems,
+// once received these are available via Bulb.GetMeshFirmware and Bulb.GetWifiFirmware
+func (c *Client) GetFirmware(bulb *Bulb) error {
+	return c.GetFirmwareCtx(context.Background(), bulb)
+}
+
+// GetFirmwareCtx is GetFirmware bounded by ctx
+func (c *Client) GetFirmwareCtx(ctx context.Context, bulb *Bulb) error {
+	err := c.sendTo(ctx, bulb, newGetFirmwareCommandFromBulb(PktGetMeshFirmware, bulb.LifxAddress))
+
+	if err != nil {
+		return err
+	}
+
+	return c.sendTo(ctx, bulb, newGetFirmwareCommandFromBulb(PktGetWifiFirmware, bulb.LifxAddress))
+}
+
+// GetInfo send a notification to the bulb to emit it's time, uptime and downtime,
+// once received these are available via Bulb.GetInfo and subscribers are notified with the bulb
+func (c *Client) GetInfo(bulb *Bulb) error {
+	return c.GetInfoCtx(context.Background(), bulb)
+}
+
+// GetInfoCtx is GetInfo bounded by ctx
+func (c *Client) GetInfoCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetInfoCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetRailVoltage send a notification to the bulb to emit it's MCU rail voltage,
+// this is delivered to subscribers as a *McuRailVoltage
+func (c *Client) GetRailVoltage(bulb *Bulb) error {
+	return c.GetRailVoltageCtx(context.Background(), bulb)
+}
+
+// GetRailVoltageCtx is GetRailVoltage bounded by ctx
+func (c *Client) GetRailVoltageCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetMcuRailVoltageCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// Reboot restarts a single bulb, opts.Confirm must be set to the bulbs lifx address
+func (c *Client) Reboot(bulb *Bulb, opts RebootOptions) error {
+	return c.RebootCtx(context.Background(), bulb, opts)
+}
+
+// RebootCtx is Reboot bounded by ctx
+func (c *Client) RebootCtx(ctx context.Context, bulb *Bulb, opts RebootOptions) error {
+	if bulb.LifxAddress == emptyAddr {
+		return fmt.Errorf("refusing to reboot without a bulb address")
+	}
+
+	if opts.Confirm != bulb.GetLifxAddress() {
+		return fmt.Errorf("reboot of %s not confirmed, got %q", bulb.GetLifxAddress(), opts.Confirm)
+	}
+
+	cmd := newRebootCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetMeshInfo send a notification to the bulb to emit it's mesh link quality,
+// once received this is available via Bulb.GetMesh
+func (c *Client) GetMeshInfo(bulb *Bulb) error {
+	return c.GetMeshInfoCtx(context.Background(), bulb)
+}
+
+// GetMeshInfoCtx is GetMeshInfo bounded by ctx
+func (c *Client) GetMeshInfoCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetMeshInfoCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// Topology returns each known gateway along with the bulbs reached through it,
+// the link quality of each bulb is available via Bulb.GetMesh
+func (c *Client) Topology() []GatewayTopology {
+	gateways := c.getGateways()
+	topology := make([]GatewayTopology, 0, len(gateways))
+
+	for _, gw := range gateways {
+		gt := GatewayTopology{Gateway: gw}
+
+		for _, bulb := range c.GetBulbs() {
+			if bulb.getGatewayAddress() == gw.hostAddress {
+				gt.Bulbs = append(gt.Bulbs, bulb)
+			}
+		}
+
+		topology = append(topology, gt)
+	}
+
+	return topology
+}
+
+// Subscribe listen for events about bulbs and gateways, only those passing every filter are delivered.
+// Events are queued up to DefaultSubscribeCapacity with the oldest dropped once it is full.
+func (c *Client) Subscribe(filters ...Filter) *Sub {
+	return c.SubscribeWith(SubscribeOptions{Filters: filters})
+}
+
+// SubscribeRaw listen for packets from bulbs the client has no decoder for, each is delivered as a *RawPacket.
+// Requests sent to bulbs, by this or any other client, are not delivered
+func (c *Client) SubscribeRaw() *Sub {
+	return c.addSub(&c.rawSubs, SubscribeOptions{})
+}
+
+// SendRaw send a packet of any type to a bulb, the payload is sent as is after the header
+func (c *Client) SendRaw(bulb *Bulb, pktType uint16, payload []byte) error {
+	return c.SendRawCtx(context.Background(), bulb, pktType, payload)
+}
+
+// SendRawCtx is SendRaw bounded by ctx
+func (c *Client) SendRawCtx(ctx context.Context, bulb *Bulb, pktType uint16, payload []byte) error {
+	cmd := newRawCommand(pktType, payload)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// Tags returns the known tags of the LIFX cluster.
+// This requires that StartDiscovery() has been ran and fnished
+//
+// The value returned is a map[uint64][]byte.
+// The uint64 value is the tag's ID, and the byte slice is the label
+func (c *Client) Tags() map[uint64][]byte {
+	// the tags map is a moving target
+	// so we need to make a copy to return
+	tags := make(map[uint64][]byte)
+
+	// take the read lock and defer the unlock
+	c.tagsMutex.RLock()
+	defer c.tagsMutex.RUnlock()
+
+	// copy the c.tags map to the new one
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+
+	return tags
+}
+
+// CreateTag allocates a free tag in the LIFX cluster and labels it,
+// the returned tag ID can be used with TagBulb. A tag is free when it has no label
+// and no known bulb carries it, the label must not be empty as that marks a free tag.
+func (c *Client) CreateTag(label string) (uint64, error) {
+	return c.CreateTagCtx(context.Background(), label)
+}
+
+// CreateTagCtx is CreateTag bounded by ctx
+func (c *Client) CreateTagCtx(ctx context.Context, label string) (uint64, error) {
+	if label == "" {
+		return 0, fmt.Errorf("tag label must not be empty")
+	}
+
+	tags := c.Tags()
+
+	// a bulb may still carry a tag whose label hasn't been reported yet
+	var used uint64
+
+	for _, bulb := range c.GetBulbs() {
+		used |= bulb.GetTags()
+	}
+
+	for i := uint(0); i < 64; i++ {
+		tag := uint64(1) << i
+
+		if _, ok := tags[tag]; !ok && used&tag == 0 {
+			return tag, c.setTagLabel(ctx, tag, label)
+		}
+	}
+
+	return 0, fmt.Errorf("all 64 tags are in use")
+}
+
+// RenameTag changes the label of an existing tag, the label must not be empty
+func (c *Client) RenameTag(tag uint64, label string) error {
+	return c.RenameTagCtx(context.Background(), tag, label)
+}
+
+// RenameTagCtx is RenameTag bounded by ctx
+func (c *Client) RenameTagCtx(ctx context.Context, tag uint64, label string) error {
+	// an empty label frees the tag, which is left to DeleteTag
+	if label == "" {
+		return fmt.Errorf("tag label must not be empty")
+	}
+
+	if _, ok := c.Tags()[tag]; !ok {
+		return fmt.Errorf("unknown tag 0x%x", tag)
+	}
+
+	return c.setTagLabel(ctx, tag, label)
+}
+
+// DeleteTag removes the tag from every bulb carrying it and then clears the label,
+// which frees it for reuse by CreateTag
+func (c *Client) DeleteTag(tag uint64) error {
+	return c.DeleteTagCtx(context.Background(), tag)
+}
+
+// DeleteTagCtx is DeleteTag bounded by ctx
+func (c *Client) DeleteTagCtx(ctx context.Context, tag uint64) error {
+	for _, bulb := range c.GetBulbs() {
+		if bulb.GetTags()&tag != 0 {
+			err := c.UntagBulbCtx(ctx, bulb, tag)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.setTagLabel(ctx, tag, "")
+}
+
+// TagBulb adds the bulb to the tag
+func (c *Client) TagBulb(bulb *Bulb, tag uint64) error {
+	return c.TagBulbCtx(context.Background(), bulb, tag)
+}
+
+// TagBulbCtx is TagBulb bounded by ctx
+func (c *Client) TagBulbCtx(ctx context.Context, bulb *Bulb, tag uint64) error {
+	return c.setBulbTags(ctx, bulb, bulb.GetTags()|tag)
+}
+
+// UntagBulb removes the bulb from the tag
+func (c *Client) UntagBulb(bulb *Bulb, tag uint64) error {
+	return c.UntagBulbCtx(context.Background(), bulb, tag)
+}
+
+// UntagBulbCtx is UntagBulb bounded by ctx
+func (c *Client) UntagBulbCtx(ctx context.Context, bulb *Bulb, tag uint64) error {
+	return c.setBulbTags(ctx, bulb, bulb.GetTags()&^tag)
+}
+
+func (c *Client) setBulbTags(ctx context.Context, bulb *Bulb, tags uint64) error {
+	err := c.sendTo(ctx, bulb, newSetTagsCommand(tags))
+
+	if err != nil {
+		return err
+	}
+
+	// the light state will confirm this, but apply it now so consecutive changes build on each other
+	bulb.mutex.Lock()
+	bulb.tags = tags
+	bulb.mutex.Unlock()
+
+	return nil
+}
+
+func (c *Client) setTagLabel(ctx context.Context, tag uint64, name string) error {
+	label, err := encodeLabel(name)
+
+	if err != nil {
+		return err
+	}
+
+	err = c.sendToAll(ctx, newSetTagLabelsCommand(tag, label))
+
+	if err != nil {
+		return err
+	}
+
+	// apply it now rather than waiting for the next tag labels from discovery
+	c.updateTagLabels(tag, label)
+
+	return nil
+}
+
+// sendTo delivers cmd to a bulb via the gateway which last reported it, falling back to the other
+// gateways only when the send fails locally, a gateway which has gone quiet still accepts the send so it
+// is only bypassed once expireGateways drops it, up to gatewayExpiry later. A bulb with no known gateway
+// is sent the command via every gateway, succeeding if any of them accept it.
+func (c *Client) sendTo(ctx context.Context, bulb *Bulb, cmd command) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	cmd.SetLifxAddr(bulb.LifxAddress) // ensure the message is addressed to the correct bulb
+	cmd.SetSource(c.source)
+
+	gateways, routed := c.routeTo(bulb)
+
+	if len(gateways) == 0 {
+		return ErrNoGateway
+	}
+
+	var (
+		firstErr error
+		sent     bool
+	)
+
+	for _, gw := range gateways {
+		//log.Printf("sending command to %s", gw.hostAddress)
+		cmd.SetSiteAddr(gw.Site) // update the site address for each gateway
+		err := gw.sendTo(ctx, cmd)
+
+		if err == nil {
+			// a routed bulb only needs one gateway to carry the command, the rest are fallbacks
+			if routed {
+				return nil
+			}
+			sent = true
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	if sent {
+		return nil
+	}
+
+	return firstErr
+}
+
+// the gateways to try for a bulb, starting with the one which last reported it if it's still known
+func (c *Client) routeTo(bulb *Bulb) (gateways []*Gateway, routed bool) {
+	gateways = c.getGateways()
+	gatewayAddress := bulb.getGatewayAddress()
+
+	for i, gw := range gateways {
+		if gw.hostAddress == gatewayAddress {
+			gateways[0], gateways[i] = gateways[i], gateways[0]
+			return gateways, true
+		}
+	}
+
+	return gateways, false
+}
+
+func (c *Client) sendToAll(ctx context.Context, cmd command) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	cmd.SetSource(c.source)
+
+	gateways := c.getGateways()
+
+	if len(gateways) == 0 {
+		return ErrNoGateway
+	}
+
+	var firstErr error
+
+	for _, gw := range gateways {
 		//log.Printf("sending command to %s", gw.hostAddress)
 		cmd.SetSiteAddr(gw.Site) // update the site address so all globes change
-		err := gw.sendTo(cmd)
-		if err != nil {
-			return err
+		err := gw.sendTo(ctx, cmd)
+
+		// carry on so one bad gateway doesn't cut off the others
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+func (c *Client) sendToTag(ctx context.Context, tag uint64, cmd command) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	// without a tag the packet carries no target and every bulb in the site would act on it
+	if tag == 0 {
+		return fmt.Errorf("tag must not be 0")
+	}
+
+	cmd.SetSource(c.source)
+
+	gateways := c.getGateways()
+
+	if len(gateways) == 0 {
+		return ErrNoGateway
+	}
+
+	var firstErr error
+
+	for _, gw := range gateways {
+		var err error
+
+		if gw.HeaderVersion == FrameHeader {
+			// the frame header has no tag addressing, these gateways are a single bulb so check it directly
+			err = c.sendToTaggedGateway(ctx, gw, tag, cmd)
+		} else {
+			cmd.SetTagAddr(tag)
+			cmd.SetSiteAddr(gw.Site) // update the site address so all tagged globes change
+			err = gw.sendTo(ctx, cmd)
+		}
+
+		// carry on so one bad gateway doesn't cut off the others
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return firstErr
+}
+
+func (c *Client) sendToTaggedGateway(ctx context.Context, gw *Gateway, tag uint64, cmd command) error {
+	for _, bulb := range c.GetBulbs() {
+		if bulb.LifxAddress == gw.lifxAddress && bulb.GetTags()&tag != 0 {
+			cmd.SetTagAddr(0)
+			cmd.SetLifxAddr(bulb.LifxAddress)
+			return gw.sendTo(ctx, cmd)
 		}
 	}
 	return nil
 }
 
 // This function handles all response messages and dispatches events subscribers
-func (c *Client) startMainEventLoop() {
+func (c *Client) startMainEventLoop(ctx context.Context) {
 	buf := make([]byte, 1024)
 
-	go c.readCommands()
+	c.discoWg.Add(2)
+
+	go func() {
+		defer c.discoWg.Done()
+
+		c.readCommands(ctx)
+	}()
+
+	// unblock the read below once discovery is cancelled
+	go func() {
+		defer c.discoWg.Done()
+
+		<-ctx.Done()
+
+		// known gateways go back to dialling before the listening socket is closed
+		c.releaseSocket()
+
+		c.bcastSocket.Close()
+	}()
 
 	for {
 		n, addr, err := c.bcastSocket.ReadFrom(buf)
 
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			log.Fatalf("Woops %s", err)
 		}
 
 		//log.Printf("Received buffer from %+v of %x", addr, buf[:n])
 
-		cmd, err := decodeCommand(buf[:n])
+		header, cmd, err := decodePacket(buf[:n])
 
 		if err != nil {
 			//log.Printf("Error processing command: %v", err)
@@ -404,15 +1561,16 @@ func (c *Client) startMainEventLoop() {
 		//log.Printf("Recieved command: %s", reflect.TypeOf(cmd))
 
 		// dispatch a cmdEvent
-		c.commandCh <- &cmdEvent{
-			addr,
-			cmd,
+		select {
+		case c.commandCh <- &cmdEvent{addr, header, cmd}:
+		case <-ctx.Done():
+			return
 		}
 
 	}
 }
 
-func (c *Client) readCommands() {
+func (c *Client) readCommands(ctx context.Context) {
 	for {
 		select {
 		case cmde := <-c.commandCh:
@@ -422,6 +1580,8 @@ func (c *Client) readCommands() {
 			// the read from command channel has timed out
 			// this happens if all gateway(s) are offline
 			c.checkExpired()
+		case <-ctx.Done():
+			return
 		}
 
 	}
@@ -429,12 +1589,16 @@ func (c *Client) readCommands() {
 }
 
 func (c *Client) processCommandEvent(cmde *cmdEvent) {
+	if cmd, ok := cmde.cmd.(command); ok {
+		c.resolvePending(cmd.GetHeader(), cmd)
+	}
+
 	// a read from ch has occurred
 	switch cmd := cmde.cmd.(type) {
 	case *panGatewayCommand:
 		// found a gw
 		if cmd.Payload.Service == 1 {
-			gw := newGateway(cmd.Header.TargetMacAddress, cmde.addr.String(), cmd.Payload.Port, cmd.Header.Site)
+			gw := newGateway(cmd.Header.TargetMacAddress, cmde.addr.String(), uint16(cmd.Payload.Port), cmd.Header.Site, cmd.Header.Version)
 			c.addGateway(gw)
 		}
 
@@ -442,6 +1606,9 @@ func (c *Client) processCommandEvent(cmde *cmdEvent) {
 		// found a bulb
 		bulb := newBulb(cmd.Header.TargetMacAddress)
 		bulb.lastLightState = cmd
+		bulb.label = decodeLabel(cmd.Payload.BulbLabel)
+		bulb.tags = cmd.Payload.Tags
+		bulb.gatewayAddress = cmde.addr.String()
 
 		bulb.bulbState = newBulbState(cmd.Payload.Hue, cmd.Payload.Saturation, cmd.Payload.Brightness, cmd.Payload.Kelvin, cmd.Payload.Dim, cmd.Payload.Power, true)
 
@@ -455,32 +1622,144 @@ func (c *Client) processCommandEvent(cmde *cmdEvent) {
 
 		c.updateAmbientLightState(cmd.Header.TargetMacAddress, cmd.Payload.Lux)
 
+	case *timeStateCommand:
+		c.updateTimeState(cmd.Header.TargetMacAddress, cmd.Payload.Time)
+
+	case *infoStateCommand:
+		c.updateBulbInfo(cmd.Header.TargetMacAddress, DeviceInfo{
+			Time:     time.Unix(0, int64(cmd.Payload.Time)),
+			Uptime:   time.Duration(cmd.Payload.Uptime),
+			Downtime: time.Duration(cmd.Payload.Downtime),
+		})
+
+	case *mcuRailVoltageCommand:
+		mcuRailVoltage := &McuRailVoltage{cmd.Header.TargetMacAddress, cmd.Payload.Voltage}
+
+		// notify subscribers
+		c.notifySubs(mcuRailVoltage)
+
+	case *resetSwitchStateCommand:
+		c.updateBulbResetSwitch(cmd.Header.TargetMacAddress, ResetSwitch(cmd.Payload.Position))
+
+	case *meshInfoCommand:
+		c.updateBulbMeshInfo(cmd.Header.TargetMacAddress, MeshInfo{cmd.Payload.Signal, cmd.Payload.Tx, cmd.Payload.Rx, cmd.Payload.McuTemperature})
+
+	case *wifiInfoCommand:
+		c.updateWifiInfo(cmd)
+
+	case *wifiStateCommand:
+		c.updateWifiState(cmd)
+
+	case *accessPointCommand:
+		c.updateAccessPoint(cmd)
+
+	case *firmwareStateCommand:
+		c.updateBulbFirmware(cmd.Header.TargetMacAddress, cmd.Header.PacketType, newFirmwareInfo(cmd.Payload.Build, cmd.Payload.Version))
+
+	case *versionStateCommand:
+		c.updateBulbHardware(cmd.Header.TargetMacAddress, HardwareInfo{cmd.Payload.Vendor, cmd.Payload.Product, cmd.Payload.Version})
+
+	case *bulbLabelCommand:
+		c.updateBulbLabel(cmd.Header.TargetMacAddress, decodeLabel(cmd.Payload.Label))
+
 	case *tagsCommand:
 		c.updateTags(cmd.Header.Site, cmd.Payload.Tags)
 
 	case *tagLabelsCommand:
 		c.updateTagLabels(cmd.Payload.Tags, cmd.Payload.Label)
 
-	default:
-		//log.Printf("Recieved command: %s", reflect.TypeOf(cmd))
+	case *ackCommand:
+		// only of interest to a pending request
+
+	case *rawCommand:
+		// requests from other clients, or our own seen on the broadcast address, are of no interest
+		if requestPackets[cmd.Header.PacketType] || cmd.Header.Source == c.source {
+			break
+		}
+
+		// notify raw subscribers
+		c.notifyRawSubs(&RawPacket{cmd.Header, cmd.Payload})
+
+	case protocol.Message:
+		// decoded by a packet type registered outside the package
+		c.notifySubs(&MessageReceived{cmde.header, cmd})
 	}
 }
 
 func (c *Client) checkExpired() {
 	// /log.Printf("Check expired devices")
 
-	for _, bulb := range c.bulbs {
-		if time.Now().Sub(bulb.lastSeen) > 10*time.Second {
-			if bulb.GetState().Visible {
-				//log.Printf("notifying bulb %s offline", bulb.GetLifxAddress())
-				bulb.bulbState.Visible = false
-				if bulb.stateHandler != nil {
-					bulb.stateHandler(bulb.bulbState)
-				}
+	for _, bulb := range c.GetBulbs() {
+		bulb.mutex.RLock()
+		lastSeen := bulb.lastSeen
+		bulb.mutex.RUnlock()
+
+		if time.Now().Sub(lastSeen) > 10*time.Second {
+			//log.Printf("notifying bulb %s offline", bulb.GetLifxAddress())
+			change := bulb.changeState(func(state *BulbState) {
+				state.Visible = false
+			})
+
+			if change != nil {
+				// notify subscribers
+				c.notifySubs(&BulbLost{bulb})
 			}
 		}
 	}
 
+	c.expireGateways()
+
+	c.pollResetSwitches()
+}
+
+// drop gateways which have stopped answering discovery, commands for their bulbs fall back to the rest
+func (c *Client) expireGateways() {
+	var lost []Event
+
+	c.devicesMutex.Lock()
+
+	gateways := c.gateways[:0]
+
+	for _, gw := range c.gateways {
+		gw.mutex.RLock()
+		lastSeen := gw.lastSeen
+		gw.mutex.RUnlock()
+
+		if time.Now().Sub(lastSeen) > gatewayExpiry {
+			lost = append(lost, &GatewayLost{gw})
+			continue
+		}
+
+		gateways = append(gateways, gw)
+	}
+
+	// clear the tail so the dropped gateways can be collected
+	for i := len(gateways); i < len(c.gateways); i++ {
+		c.gateways[i] = nil
+	}
+
+	c.gateways = gateways
+
+	c.devicesMutex.Unlock()
+
+	// notify subscribers
+	c.notifySubs(lost...)
+}
+
+// ask each visible bulb for the position of it's reset switch so a press can be reported
+// before a held switch factory resets the bulb
+func (c *Client) pollResetSwitches() {
+	if time.Now().Sub(c.lastResetSwitchPoll) < resetSwitchPollInterval {
+		return
+	}
+
+	c.lastResetSwitchPoll = time.Now()
+
+	for _, bulb := range c.GetBulbs() {
+		if bulb.GetState().Visible {
+			c.sendTo(context.Background(), bulb, newGetResetSwitchStateCommandFromBulb(bulb.LifxAddress))
+		}
+	}
 }
 
 func (c *Client) sendDiscovery(t time.Time) {
@@ -508,62 +1787,226 @@ func (c *Client) sendDiscovery(t time.Time) {
 }
 
 func (c *Client) addGateway(gw *Gateway) {
+	gw.socket = c.bcastSocket
+	gw.source = c.source
+
+	c.devicesMutex.Lock()
+
 	if !gatewayInSlice(gw, c.gateways) {
 		//log.Printf("Added gw %v", gw)
 		gw.lastSeen = time.Now()
 		c.gateways = append(c.gateways, gw)
 
+		c.devicesMutex.Unlock()
+
 		// notify subscribers
-		go c.notifySubsGwNew(gw)
+		c.notifySubs(&GatewayDiscovered{gw})
 
 	} else {
 		for _, lgw := range c.gateways {
 			if gw.lifxAddress == lgw.lifxAddress && gw.Port == lgw.Port && gw.hostAddress == lgw.hostAddress {
-				gw.lastSeen = time.Now()
+				lgw.mutex.Lock()
+				lgw.lastSeen = time.Now()
+				lgw.socket = c.bcastSocket // replaced when discovery is restarted
+				lgw.mutex.Unlock()
 				//log.Printf("update last seen for %v %s", gw.hostAddress, gw.lastSeen)
 			}
 		}
+
+		c.devicesMutex.Unlock()
 	}
 
-	gw.findBulbs()
+	gw.findBulbs(context.Background())
 }
 
 func (c *Client) addBulb(bulb *Bulb) {
-	if !bulbInSlice(bulb, c.bulbs) {
+	c.devicesMutex.Lock()
+
+	found := !bulbInSlice(bulb, c.bulbs)
+
+	if found {
 		bulb.lastSeen = time.Now()
 		c.bulbs = append(c.bulbs, bulb)
 
 		// log.Printf("Added bulb %x state %v", bulb.LifxAddress, bulb.bulbState)
+	}
 
+	c.devicesMutex.Unlock()
+
+	if found {
 		// notify subscribers
-		go c.notifySubsBulbNew(bulb)
+		c.notifySubs(&BulbDiscovered{bulb})
 	}
-	for _, lbulb := range c.bulbs {
+	for _, lbulb := range c.GetBulbs() {
 		if bulb.LifxAddress == lbulb.LifxAddress {
-			lbulb.update(bulb)
+			// firmware only changes across a reboot so refresh it as the bulb (re)appears
+			if found || !lbulb.GetState().Visible {
+				c.GetFirmware(lbulb)
+			}
+			// the light state carries the label so changes made elsewhere arrive here
+			relabelled := lbulb.GetLabel() != bulb.label
+
+			c.notifyStateChanged(lbulb.update(bulb))
+
+			if relabelled {
+				// notify subscribers
+				c.notifySubs(&BulbUpdated{lbulb})
+			}
 		}
 	}
 }
 
 func (c *Client) updateBulbPowerState(lifxAddress [6]byte, onoff uint16) {
-	for _, b := range c.bulbs {
+	for _, b := range c.GetBulbs() {
 		// this needs further investigation
 		if lifxAddress == b.LifxAddress {
-			b.bulbState.Power = onoff
+			change := b.changeState(func(state *BulbState) {
+				state.Power = onoff
+			})
 			// log.Printf("Updated bulb %v", b)
 
 			// notify subscribers
-			go c.notifySubsBulbNew(b)
+			c.notifyStateChanged(change)
+		}
+	}
+}
+
+func (c *Client) updateBulbFirmware(lifxAddress [6]byte, packetType uint16, fw FirmwareInfo) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress == b.LifxAddress {
+			b.mutex.Lock()
+			if packetType == PktMeshFirmwareState {
+				b.meshFirmware = fw
+			} else {
+				b.wifiFirmware = fw
+			}
+			b.mutex.Unlock()
+
+			// notify subscribers
+			c.notifySubs(&BulbUpdated{b})
+		}
+	}
+}
+
+func (c *Client) updateBulbLabel(lifxAddress [6]byte, label string) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress == b.LifxAddress && label != b.GetLabel() {
+			b.mutex.Lock()
+			b.label = label
+			b.mutex.Unlock()
+
+			// notify subscribers
+			c.notifySubs(&BulbUpdated{b})
+		}
+	}
+}
+
+func (c *Client) updateBulbInfo(lifxAddress [6]byte, info DeviceInfo) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress == b.LifxAddress {
+			b.mutex.Lock()
+			previous := b.info
+			b.info = info
+			b.mutex.Unlock()
+
+			// notify subscribers, of the reboot first if uptime has gone backwards
+			if previous.Uptime != 0 && info.Uptime < previous.Uptime {
+				c.notifySubs(&BulbRebooted{b, previous.Uptime, info.Uptime}, &BulbUpdated{b})
+			} else {
+				c.notifySubs(&BulbUpdated{b})
+			}
+		}
+	}
+}
+
+func (c *Client) updateBulbResetSwitch(lifxAddress [6]byte, position ResetSwitch) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress != b.LifxAddress {
+			continue
+		}
+
+		b.mutex.Lock()
+		changed := position != b.resetSwitch
+		b.resetSwitch = position
+		b.mutex.Unlock()
+
+		if changed {
+			// notify subscribers
+			c.notifySubs(&ResetSwitchState{lifxAddress, position})
 		}
 	}
 }
 
+func (c *Client) updateBulbMeshInfo(lifxAddress [6]byte, mesh MeshInfo) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress == b.LifxAddress {
+			// refreshed on each discovery so this is updated without notifying subscribers
+			b.mutex.Lock()
+			b.mesh = mesh
+			b.mutex.Unlock()
+		}
+	}
+}
+
+func (c *Client) updateBulbHardware(lifxAddress [6]byte, hw HardwareInfo) {
+	for _, b := range c.GetBulbs() {
+		if lifxAddress == b.LifxAddress {
+			b.mutex.Lock()
+			b.hardware = hw
+			b.mutex.Unlock()
+
+			// notify subscribers
+			c.notifySubs(&BulbUpdated{b})
+		}
+	}
+}
+
+// the light state will confirm the dim level, until then keep the state in line with what was sent
+func (c *Client) updateBulbDim(bulb *Bulb, dim uint16) {
+	change := bulb.changeState(func(state *BulbState) {
+		state.Dim = dim
+	})
+
+	c.notifyStateChanged(change)
+}
+
+func (c *Client) adjustBulbDim(bulb *Bulb, delta int16) {
+	change := bulb.changeState(func(state *BulbState) {
+		state.Dim = adjustDim(state.Dim, delta)
+	})
+
+	c.notifyStateChanged(change)
+}
+
+// the bulb clamps relative changes to the range of the dim level
+func adjustDim(dim uint16, delta int16) uint16 {
+	adjusted := int32(dim) + int32(delta)
+
+	switch {
+	case adjusted < 0:
+		return 0
+	case adjusted > 0xffff:
+		return 0xffff
+	}
+
+	return uint16(adjusted)
+}
+
 // as these readings are independent of the bulb state i am emitting them seperately
 func (c *Client) updateAmbientLightState(lifxAddress [6]byte, lux float32) {
-	lightSensorState := &LightSensorState{lifxAddress, lux}
+	lightSensorState := &SensorReading{lifxAddress, lux}
+
+	// notify subscribers
+	c.notifySubs(lightSensorState)
+}
+
+// like the light sensor the time is emitted seperately from the bulb state
+func (c *Client) updateTimeState(lifxAddress [6]byte, nanos uint64) {
+	t := time.Unix(0, int64(nanos))
+	timeState := &TimeState{lifxAddress, t, t.Sub(time.Now())}
 
 	// notify subscribers
-	go c.notifySubsSensorReading(lightSensorState)
+	c.notifySubs(timeState)
 }
 
 // we've received a new tagsCommand packet, so let's update
@@ -571,7 +2014,7 @@ func (c *Client) updateAmbientLightState(lifxAddress [6]byte, lux float32) {
 func (c *Client) updateTags(site [6]byte, tags uint64) {
 	// send this request to all to make sure we
 	// get a list of all of the tags in use
-	c.sendToAll(newGetTagLabelsCommand(site, tags))
+	c.sendToAll(context.Background(), newGetTagLabelsCommand(site, tags))
 }
 
 // we've received a response regarding a specific tag's label,
@@ -580,23 +2023,19 @@ func (c *Client) updateTagLabels(tags uint64, label [32]byte) {
 	// convert the byte array to a byte slice with null bytes removed
 	labelSlice := bytes.Trim(label[:], "\x00")
 
+	// take the write lock and defer the unlock, callers other than the event loop may update the labels
+	c.tagsMutex.Lock()
+	defer c.tagsMutex.Unlock()
+
 	// if the label is empty and c.tags isn't nil:
 	// make sure that tag is removed from the map
 	if len(labelSlice) == 0 && c.tags != nil {
-		// take the write lock and defer the unlock
-		c.tagsMutex.Lock()
-		defer c.tagsMutex.Unlock()
-
 		// delete the tags value from the c.tags map
 		delete(c.tags, tags)
 
 		return
 	}
 
-	// take the write lock and defer the unlock
-	c.tagsMutex.Lock()
-	defer c.tagsMutex.Unlock()
-
 	if c.tags == nil {
 		c.tags = make(map[uint64][]byte)
 	}
@@ -604,36 +2043,65 @@ func (c *Client) updateTagLabels(tags uint64, label [32]byte) {
 	c.tags[tags] = labelSlice
 }
 
-func (c *Client) notifySubsGwNew(gw *Gateway) {
-	for _, sub := range c.subs {
-		// check if it is open
-		sub.Events <- gw
-	}
+// pass events to each subscriber via the out channel, in order
+func (c *Client) notifySubs(events ...Event) {
+	c.subsMutex.RLock()
+	subs := append([]*Sub(nil), c.subs...)
+	c.subsMutex.RUnlock()
+
+	c.notify(subs, events...)
+}
+
+// pass an undecoded packet to each raw subscriber via the out channel
+func (c *Client) notifyRawSubs(raw *RawPacket) {
+	c.subsMutex.RLock()
+	subs := append([]*Sub(nil), c.rawSubs...)
+	c.subsMutex.RUnlock()
+
+	c.notify(subs, raw)
 }
 
-// dereference bulb and pass it to the subscriber via the out channel
-func (c *Client) notifySubsBulbNew(bulb *Bulb) {
-	for _, sub := range c.subs {
-		// check if it is open
-		sub.Events <- bulb
+// queue each event for the subscribers whose filters pass it, this only waits on subscribers which block
+func (c *Client) notify(subs []*Sub, events ...Event) {
+	for _, event := range events {
+		var bulb *Bulb
+		var looked bool
+
+		for _, sub := range subs {
+			// only look for the bulb if a filter needs it
+			if len(sub.filters) > 0 && !looked {
+				bulb, looked = c.bulbByAddress(event.GetLifxAddress()), true
+			}
+
+			if sub.accepts(event, bulb) {
+				sub.enqueue(event)
+			}
+		}
 	}
 }
 
-// dereference light sensor and pass it to the subscriber via the out channel
-func (c *Client) notifySubsSensorReading(lightsensor *LightSensorState) {
-	for _, sub := range c.subs {
-		// check if it is open
-		sub.Events <- lightsensor
+func (c *Client) bulbByAddress(lifxAddress string) *Bulb {
+	for _, bulb := range c.GetBulbs() {
+		if bulb.GetLifxAddress() == lifxAddress {
+			return bulb
+		}
 	}
+	return nil
 }
 
-// Sub subscription of changes
-type Sub struct {
-	Events chan interface{}
+// labels are stored in a fixed size null padded field
+func encodeLabel(name string) (label [MaxLabelLen]byte, err error) {
+	if len(name) > MaxLabelLen {
+		return label, fmt.Errorf("label %q is longer than %d bytes", name, MaxLabelLen)
+	}
+
+	copy(label[:], name)
+
+	return label, nil
 }
 
-func newSub() *Sub {
-	return &Sub{Events: make(chan interface{}, 1)}
+func decodeLabel(label [MaxLabelLen]byte) string {
+	return string(bytes.Trim(label[:], "\x00"))
 }
 
 func gatewayInSlice(a *Gateway, list []*Gateway) bool {
@@ -0,0 +1,1118 @@
+package lifx
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/wolfeidau/lifx/protocol"
+)
+
+// a gateway which delivers the commands sent by c to the returned listener
+func listenAsGateway(t *testing.T, c *Client) *net.UDPConn {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gw := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, listener.LocalAddr().String(), 56700, [6]byte{}, LegacyHeader)
+	c.gateways = append(c.gateways, gw)
+
+	return listener
+}
+
+func TestCreateTagAllocatesFreeTag(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	var label [32]byte
+	copy(label[:], "Lounge")
+
+	c.updateTagLabels(0x1, label)
+	c.updateTagLabels(0x4, label)
+
+	tag, err := c.CreateTag("Kitchen")
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if tag != 0x2 {
+		t.Fatalf("expected %x, got: %x", 0x2, tag)
+	}
+
+	if got := string(c.Tags()[tag]); got != "Kitchen" {
+		t.Fatalf("expected Kitchen, got: %s", got)
+	}
+
+	if err := c.RenameTag(tag, ""); err == nil {
+		t.Fatal("expected renaming to an empty label to be rejected")
+	}
+
+	if _, ok := c.Tags()[tag]; !ok {
+		t.Fatalf("expected tag %x to be kept", tag)
+	}
+
+	err = c.DeleteTag(tag)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := c.Tags()[tag]; ok {
+		t.Fatalf("expected tag %x to be deleted", tag)
+	}
+}
+
+func TestDeleteTagRacesTagLabels(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	var label [32]byte
+	copy(label[:], "Lounge")
+
+	done := make(chan struct{})
+
+	// labels arriving from discovery while a tag is deleted, run with -race
+	go func() {
+		defer close(done)
+
+		c.updateTagLabels(0x1, label)
+	}()
+
+	// give the labels a head start, sleeping doesn't order the two for the race detector
+	time.Sleep(10 * time.Millisecond)
+
+	if err := c.DeleteTag(0x2); err != nil {
+		t.Error(err)
+	}
+
+	<-done
+}
+
+func TestCreateTagSkipsTagsCarriedByBulbs(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0xffff, 3500, 0xffff, bulbOn, true)
+	bulb.tags = 0x3
+	c.addBulb(bulb)
+
+	if _, err := c.CreateTag(""); err == nil {
+		t.Fatal("expected an empty label to be rejected")
+	}
+
+	tag, err := c.CreateTag("Kitchen")
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if tag != 0x4 {
+		t.Fatalf("expected %x, got: %x", 0x4, tag)
+	}
+}
+
+func TestSetDimKeepsBulbStateConsistent(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0xffff, 3500, 0x1000, bulbOn, true)
+	c.addBulb(bulb)
+
+	err := c.SetDim(bulb, 0x8000, 0)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if bulb.GetState().Dim != 0x8000 {
+		t.Fatalf("expected %x, got: %x", 0x8000, bulb.GetState().Dim)
+	}
+
+	err = c.AdjustDim(bulb, 0x7fff, 0)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if bulb.GetState().Dim != 0xffff {
+		t.Fatalf("expected %x, got: %x", 0xffff, bulb.GetState().Dim)
+	}
+}
+
+func TestSetDimWithoutGatewayKeepsState(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0xffff, 3500, 0x1000, bulbOn, true)
+	c.addBulb(bulb)
+
+	sub := c.Subscribe(FilterKind(KindBulbStateChanged))
+
+	if err := c.SetDim(bulb, 0x8000, 0); err != ErrNoGateway {
+		t.Fatalf("expected %v, got: %v", ErrNoGateway, err)
+	}
+
+	if err := c.LightsDim(0x8000, 0); err != ErrNoGateway {
+		t.Fatalf("expected %v, got: %v", ErrNoGateway, err)
+	}
+
+	if bulb.GetState().Dim != 0x1000 {
+		t.Fatalf("expected %x, got: %x", 0x1000, bulb.GetState().Dim)
+	}
+
+	select {
+	case event := <-sub.Events:
+		t.Fatalf("expected no state change for a command never sent, got: %T", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSetAccessPointValidation(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+
+	if err := c.SetAccessPoint(bulb, "", "secret", SecurityWPA2AESPSK); err == nil {
+		t.Fatal("expected error for empty ssid")
+	}
+
+	if err := c.SetAccessPoint(bulb, "home", "secret", SecurityProtocol(0)); err == nil {
+		t.Fatal("expected error for unknown security protocol")
+	}
+
+	if err := c.SetAccessPoint(bulb, "home", "secret", SecurityWPA2AESPSK); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTopologyGroupsBulbsByGateway(t *testing.T) {
+	c := NewClient()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x03})
+	bulb.bulbState = newBulbState(0, 0, 0, 0, 0, bulbOn, true)
+	bulb.gatewayAddress = "10.0.0.2:56700"
+	c.addBulb(bulb)
+
+	site := [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}
+	gw1 := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, "10.0.0.1:56700", 56700, site, LegacyHeader)
+	gw2 := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}, "10.0.0.2:56700", 56700, site, LegacyHeader)
+	c.gateways = append(c.gateways, gw1, gw2)
+
+	c.updateBulbMeshInfo(bulb.LifxAddress, MeshInfo{Signal: 0.5})
+
+	topology := c.Topology()
+
+	if len(topology) != 2 {
+		t.Fatalf("expected %d, got: %d", 2, len(topology))
+	}
+
+	if len(topology[0].Bulbs) != 0 || len(topology[1].Bulbs) != 1 {
+		t.Fatalf("expected bulb behind second gateway, got: %v", topology)
+	}
+
+	if topology[1].Bulbs[0].GetMesh().Signal != 0.5 {
+		t.Fatalf("expected signal %f, got: %f", 0.5, topology[1].Bulbs[0].GetMesh().Signal)
+	}
+}
+
+func TestGetInfoEmitsRebootWhenUptimeGoesBackwards(t *testing.T) {
+	c := NewClient()
+	sub := c.Subscribe()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0, 0, 0, bulbOn, true)
+	c.bulbs = append(c.bulbs, bulb)
+
+	c.updateBulbInfo(bulb.LifxAddress, DeviceInfo{Uptime: time.Hour})
+	<-sub.Events
+
+	c.updateBulbInfo(bulb.LifxAddress, DeviceInfo{Uptime: time.Minute})
+
+	switch event := (<-sub.Events).(type) {
+	case *BulbRebooted:
+		if event.PreviousUptime != time.Hour || event.Uptime != time.Minute {
+			t.Fatalf("expected %s then %s, got: %s then %s", time.Hour, time.Minute, event.PreviousUptime, event.Uptime)
+		}
+	default:
+		t.Fatalf("expected BulbRebooted, got: %T", event)
+	}
+
+	if bulb.GetInfo().Uptime != time.Minute {
+		t.Fatalf("expected %s, got: %s", time.Minute, bulb.GetInfo().Uptime)
+	}
+}
+
+func TestRebootRequiresConfirmation(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+
+	if err := c.Reboot(bulb, RebootOptions{}); err == nil {
+		t.Fatal("expected error without confirmation")
+	}
+
+	if err := c.Reboot(bulb, RebootOptions{Confirm: "d073d50035f8"}); err == nil {
+		t.Fatal("expected error confirming a different bulb")
+	}
+
+	if err := c.Reboot(bulb, RebootOptions{Confirm: bulb.GetLifxAddress()}); err != nil {
+		t.Error(err)
+	}
+
+	if err := c.Reboot(newBulb(emptyAddr), RebootOptions{Confirm: "000000000000"}); err == nil {
+		t.Fatal("expected error rebooting without a bulb address")
+	}
+}
+
+func TestResetSwitchEmitsOnChange(t *testing.T) {
+	c := NewClient()
+	sub := c.Subscribe()
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0, 0, 0, bulbOn, true)
+	c.bulbs = append(c.bulbs, bulb)
+
+	c.updateBulbResetSwitch(bulb.LifxAddress, ResetSwitchUp)
+	c.updateBulbResetSwitch(bulb.LifxAddress, ResetSwitchDown)
+
+	switch event := (<-sub.Events).(type) {
+	case *ResetSwitchState:
+		if event.Position != ResetSwitchDown {
+			t.Fatalf("expected %s, got: %s", ResetSwitchDown, event.Position)
+		}
+	default:
+		t.Fatalf("expected ResetSwitchState, got: %T", event)
+	}
+
+	select {
+	case event := <-sub.Events:
+		t.Fatalf("expected no further events, got: %T", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// run a synchronous call in the background, returning once it's request is pending so the reply can be fed in
+func startRequest(t *testing.T, c *Client, call func() error) <-chan error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- call()
+	}()
+
+	for {
+		c.pendingMutex.Lock()
+		n := len(c.pending)
+		c.pendingMutex.Unlock()
+
+		if n > 0 {
+			return errCh
+		}
+
+		select {
+		case err := <-errCh:
+			t.Fatalf("expected the request to wait for a reply, got: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestGetStateSyncMatchesReply(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	msg, err := decodeCommand(lightStatusMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := msg.(*lightStateCommand)
+	bulb := newBulb(reply.Header.TargetMacAddress)
+
+	var state BulbState
+
+	errCh := startRequest(t, c, func() (err error) {
+		state, err = c.GetStateSync(context.Background(), bulb)
+		return err
+	})
+
+	c.processCommandEvent(&cmdEvent{cmd: reply, addr: &net.UDPAddr{}})
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Kelvin != reply.Payload.Kelvin || state.Power != reply.Payload.Power {
+		t.Fatalf("expected state from reply, got: %+v", state)
+	}
+}
+
+func TestGetStateSyncTimesOut(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	c.RequestTimeout = time.Millisecond
+	c.RequestRetries = 1
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+
+	if _, err := c.GetStateSync(context.Background(), bulb); err != ErrTimeout {
+		t.Fatalf("expected %v, got: %v", ErrTimeout, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.GetStateSync(ctx, bulb); err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestCancelledContextStopsSends(t *testing.T) {
+	c := NewClient()
+
+	gw := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}, "127.0.0.1:56700", 56700, [6]byte{}, LegacyHeader)
+	c.gateways = append(c.gateways, gw)
+
+	bulb := newBulb(gw.lifxAddress)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.LightOnCtx(ctx, bulb); err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+
+	if err := c.LightsOffCtx(ctx); err != context.Canceled {
+		t.Fatalf("expected %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestCloseClosesSubsAndRejectsSends(t *testing.T) {
+	c := NewClient()
+	sub := c.Subscribe()
+
+	// left undelivered as nothing reads the subscription
+	c.notifySubs(&TimeState{}, &TimeState{}, &TimeState{})
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range sub.Events {
+	}
+
+	if err := c.LightsOn(); err != ErrClosed {
+		t.Fatalf("expected %v, got: %v", ErrClosed, err)
+	}
+
+	if err := c.StartDiscovery(); err != ErrClosed {
+		t.Fatalf("expected %v, got: %v", ErrClosed, err)
+	}
+
+	if _, ok := <-c.Subscribe().Events; ok {
+		t.Fatal("expected subscription after close to be closed")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStopDiscoveryAllowsRestart(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	if err := c.StartDiscovery(); err != nil {
+		t.Skipf("unable to listen for broadcasts: %v", err)
+	}
+
+	if err := c.StartDiscovery(); err == nil {
+		t.Fatal("expected error starting discovery twice")
+	}
+
+	c.StopDiscovery()
+
+	if err := c.StartDiscovery(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryIsSafeWhileDiscoveryRuns(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	c.addGateway(newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}, "127.0.0.1:56700", 56700, [6]byte{}, LegacyHeader))
+
+	done := make(chan struct{})
+
+	// the event loop
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			msg, err := decodeCommand(lightStatusMsg())
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			c.processCommandEvent(&cmdEvent{cmd: msg, addr: &net.UDPAddr{}})
+			c.updateBulbPowerState(msg.(*lightStateCommand).Header.TargetMacAddress, uint16(i%2))
+			c.checkExpired()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		c.Subscribe().Close()
+
+		for _, bulb := range c.GetBulbs() {
+			bulb.GetState()
+			bulb.GetInfo()
+			c.SetDim(bulb, 0x1000, 0)
+		}
+
+		c.Topology()
+	}
+}
+
+// a message numbered i for ordering events delivered to subscribers
+func timeMessage(i int) *MessageReceived {
+	return &MessageReceived{Message: &protocol.SetTime{Time: uint64(i)}}
+}
+
+func messageTime(event Event) int {
+	return int(event.(*MessageReceived).Message.(*protocol.SetTime).Time)
+}
+
+func TestSubscribeOverflowPolicies(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	oldest := c.SubscribeWith(SubscribeOptions{Capacity: 2, Overflow: OverflowDropOldest})
+	newest := c.SubscribeWith(SubscribeOptions{Capacity: 2, Overflow: OverflowDropNewest})
+
+	for i := 0; i < 5; i++ {
+		c.notifySubs(timeMessage(i))
+	}
+
+	received := func(sub *Sub) (events []int) {
+		for {
+			select {
+			case event := <-sub.Events:
+				events = append(events, messageTime(event))
+			case <-time.After(50 * time.Millisecond):
+				return events
+			}
+		}
+	}
+
+	// the delivery goroutine may hold one event beyond the capacity of the queue
+	events := received(oldest)
+
+	if len(events) < 2 || events[len(events)-1] != 4 || uint64(len(events))+oldest.Dropped() != 5 {
+		t.Fatalf("expected the newest events and the rest dropped, got: %v with %d dropped", events, oldest.Dropped())
+	}
+
+	events = received(newest)
+
+	if len(events) < 2 || events[0] != 0 || uint64(len(events))+newest.Dropped() != 5 {
+		t.Fatalf("expected the oldest events and the rest dropped, got: %v with %d dropped", events, newest.Dropped())
+	}
+}
+
+func TestSubscribeBlockWaitsForRoom(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.SubscribeWith(SubscribeOptions{Capacity: 1, Overflow: OverflowBlock})
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 10; i++ {
+			c.notifySubs(timeMessage(i))
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if got := messageTime(<-sub.Events); got != i {
+			t.Fatalf("expected %d, got: %d", i, got)
+		}
+	}
+
+	<-done
+
+	if sub.Dropped() != 0 {
+		t.Fatalf("expected nothing dropped, got: %d", sub.Dropped())
+	}
+}
+
+func TestUnsubscribeClosesEvents(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.Subscribe()
+
+	c.notifySubs(timeMessage(1), timeMessage(2), timeMessage(3))
+
+	sub.Close()
+
+	for range sub.Events {
+	}
+
+	// the subscriber is no longer notified so this doesn't block
+	c.notifySubs(timeMessage(4), timeMessage(5), timeMessage(6))
+	sub.Close()
+}
+
+func TestBulbEventsDistinguishDiscoveryFromChanges(t *testing.T) {
+	c := NewClient()
+
+	defer c.Close()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	all := c.Subscribe()
+	changes := c.Subscribe(FilterKind(KindBulbStateChanged))
+	other := c.Subscribe(FilterBulb("d073d5000000"))
+
+	msg, err := decodeCommand(lightStatusMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lifxAddress := msg.(*lightStateCommand).Header.TargetMacAddress
+	power := msg.(*lightStateCommand).Payload.Power
+
+	c.processCommandEvent(&cmdEvent{cmd: msg, addr: &net.UDPAddr{}})
+	c.updateBulbPowerState(lifxAddress, power^0xffff)
+
+	tagged := c.Subscribe(FilterTag(0x4))
+
+	bulb := c.GetBulbs()[0]
+	c.TagBulb(bulb, 0x4)
+	c.updateBulbPowerState(lifxAddress, power)
+
+	if _, ok := (<-all.Events).(*BulbDiscovered); !ok {
+		t.Fatal("expected BulbDiscovered first")
+	}
+
+	for _, sub := range []*Sub{all, changes, tagged} {
+		switch event := (<-sub.Events).(type) {
+		case *BulbStateChanged:
+			if event.Bulb != bulb || event.Old.Power == event.New.Power {
+				t.Fatalf("expected a power change, got: %+v", event)
+			}
+		default:
+			t.Fatalf("expected BulbStateChanged, got: %T", event)
+		}
+	}
+
+	select {
+	case event := <-other.Events:
+		t.Fatalf("expected no events for another bulb, got: %T", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSendToFallsBackWhenRoutedGatewayFails(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// missing a port so every send through it fails
+	bad := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, "127.0.0.1", 56700, [6]byte{}, LegacyHeader)
+	good := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}, listener.LocalAddr().String(), 56700, [6]byte{}, LegacyHeader)
+	c.gateways = append(c.gateways, good, bad)
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.gatewayAddress = bad.hostAddress
+
+	if gateways, routed := c.routeTo(bulb); !routed || gateways[0] != bad {
+		t.Fatalf("expected to be routed through %s first, got: %v", bad.hostAddress, gateways)
+	}
+
+	if err := c.LightOn(bulb); err != nil {
+		t.Fatalf("expected fallback to succeed, got: %v", err)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 128)
+	n, _, err := listener.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := decodeCommand(buf[:n])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.(command).GetHeader().TargetMacAddress != bulb.LifxAddress {
+		t.Fatalf("expected command for %s, got: %+v", bulb.GetLifxAddress(), cmd)
+	}
+}
+
+// the header of the next packet sent to listener
+func readHeader(t *testing.T, listener *net.UDPConn) *Header {
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 128)
+	n, _, err := listener.ReadFrom(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := decodePacketHeader(buf[:n])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestSendToTagAddressesLegacyGatewaysByTag(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	site := [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}
+	gw := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, listener.LocalAddr().String(), 56700, site, LegacyHeader)
+	c.gateways = append(c.gateways, gw)
+
+	if err := c.TagOn(0); err == nil {
+		t.Fatal("expected tag 0 to be rejected")
+	}
+
+	if err := c.TagOn(0x2); err != nil {
+		t.Fatal(err)
+	}
+
+	h := readHeader(t, listener)
+
+	// the first packet through is the tagged one, tag 0 was never sent
+	if h.Protocol&0x2000 == 0 || h.TargetMacAddress != [6]byte{0x02} || h.Site != site {
+		t.Fatalf("expected a packet tagged 0x2 for the site, got: %+v", h)
+	}
+}
+
+func TestSendToTagAddressesFrameGatewaysByBulb(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	untagged := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, listener.LocalAddr().String(), 56700, [6]byte{}, FrameHeader)
+	tagged := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}, listener.LocalAddr().String(), 56700, [6]byte{}, FrameHeader)
+	c.gateways = append(c.gateways, untagged, tagged)
+
+	for _, gw := range c.gateways {
+		bulb := newBulb(gw.lifxAddress)
+		bulb.bulbState = newBulbState(0, 0, 0xffff, 3500, 0xffff, bulbOn, true)
+
+		if gw == tagged {
+			bulb.tags = 0x2
+		}
+
+		c.addBulb(bulb)
+	}
+
+	if err := c.TagOn(0x2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bulbs are also asked for their firmware as they're added, only the power changes matter here
+	var sent [][6]byte
+
+	for {
+		listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+		buf := make([]byte, 128)
+		n, _, err := listener.ReadFrom(buf)
+
+		if err != nil {
+			break
+		}
+
+		h, err := decodePacketHeader(buf[:n])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.PacketType == PktSetPowerState {
+			if h.Protocol&0x2000 != 0 {
+				t.Fatalf("expected an untagged packet, got: %+v", h)
+			}
+			sent = append(sent, h.TargetMacAddress)
+		}
+	}
+
+	if len(sent) != 1 || sent[0] != tagged.lifxAddress {
+		t.Fatalf("expected only %s to be sent the command, got: %x", tagged.GetLifxAddress(), sent)
+	}
+}
+
+func TestSendToUnroutedSucceedsWhenAnyGatewayAccepts(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// missing a port so every send through it fails
+	bad := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, "127.0.0.1", 56700, [6]byte{}, LegacyHeader)
+	good := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}, listener.LocalAddr().String(), 56700, [6]byte{}, LegacyHeader)
+	c.gateways = append(c.gateways, bad, good)
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+
+	if _, routed := c.routeTo(bulb); routed {
+		t.Fatal("expected a bulb with no gateway to be unrouted")
+	}
+
+	if err := c.LightOn(bulb); err != nil {
+		t.Fatalf("expected send to succeed when any gateway accepts it, got: %v", err)
+	}
+
+	c.gateways = []*Gateway{bad}
+
+	if err := c.LightOn(bulb); err == nil {
+		t.Fatal("expected an error when every gateway fails")
+	}
+}
+
+func TestSilentGatewaysExpire(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.Subscribe(FilterKind(KindGatewayLost))
+
+	silent := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01}, "127.0.0.1:56700", 56700, [6]byte{}, LegacyHeader)
+	silent.lastSeen = time.Now().Add(-2 * gatewayExpiry)
+
+	alive := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02}, "127.0.0.2:56700", 56700, [6]byte{}, LegacyHeader)
+	alive.lastSeen = time.Now()
+
+	c.gateways = append(c.gateways, silent, alive)
+
+	c.checkExpired()
+
+	switch event := (<-sub.Events).(type) {
+	case *GatewayLost:
+		if event.Gateway != silent {
+			t.Fatalf("expected %s lost, got: %s", silent.GetLifxAddress(), event.GetLifxAddress())
+		}
+	default:
+		t.Fatalf("expected GatewayLost, got: %T", event)
+	}
+
+	if gateways := c.getGateways(); len(gateways) != 1 || gateways[0] != alive {
+		t.Fatalf("expected only %s to remain, got: %v", alive.GetLifxAddress(), gateways)
+	}
+}
+
+func TestSendAfterStopDiscovery(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	if err := c.StartDiscovery(); err != nil {
+		t.Skipf("unable to listen for broadcasts: %v", err)
+	}
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	gw := newGateway([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}, listener.LocalAddr().String(), 56700, [6]byte{}, FrameHeader)
+	c.addGateway(gw)
+
+	// seen again by the event loop after the socket is closed, which hands the closed socket back
+	c.discoWg.Add(1)
+
+	go func() {
+		defer c.discoWg.Done()
+
+		time.Sleep(20 * time.Millisecond)
+		c.addGateway(newGateway(gw.lifxAddress, gw.hostAddress, gw.Port, gw.Site, FrameHeader))
+	}()
+
+	c.StopDiscovery()
+
+	for _, gw := range c.getGateways() {
+		gw.mutex.RLock()
+		socket := gw.socket
+		gw.mutex.RUnlock()
+
+		if socket != nil {
+			t.Fatalf("expected %s to stop using the listening socket", gw.GetLifxAddress())
+		}
+	}
+
+	if err := c.LightOn(newBulb(gw.lifxAddress)); err != nil {
+		t.Fatalf("expected send after stopping discovery to succeed, got: %v", err)
+	}
+}
+
+func TestLightOnSyncIgnoresStaleLegacyState(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	msg, err := decodeCommand(powerStateMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := msg.(*powerStateCommand)
+
+	if reply.Header.Version != LegacyHeader {
+		t.Fatalf("expected a legacy reply, got: %v", reply.Header.Version)
+	}
+
+	bulb := newBulb(reply.Header.TargetMacAddress)
+
+	errCh := startRequest(t, c, func() error {
+		return c.LightOnSync(context.Background(), bulb)
+	})
+
+	// the routine reply to discovery still has the bulb off
+	reply.Payload.OnOff = bulbOff
+	c.processCommandEvent(&cmdEvent{cmd: reply, addr: &net.UDPAddr{}})
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("expected the off state not to confirm, got: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	on := *reply
+	on.Payload.OnOff = 0xffff
+	c.processCommandEvent(&cmdEvent{cmd: &on, addr: &net.UDPAddr{}})
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNextSequenceSkipsZero(t *testing.T) {
+	c := NewClient()
+	c.sequence = 0xff
+
+	if sequence := c.nextSequence(); sequence != 1 {
+		t.Fatalf("expected 1, got: %d", sequence)
+	}
+}
+
+func TestLightStateWithNewLabelNotifies(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	msg, err := decodeCommand(lightStatusMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.processCommandEvent(&cmdEvent{cmd: msg, addr: &net.UDPAddr{}})
+
+	sub := c.Subscribe(FilterKind(KindBulbUpdated))
+
+	relabelled, err := decodeCommand(lightStatusMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	label, _ := encodeLabel("Renamed")
+	relabelled.(*lightStateCommand).Payload.BulbLabel = label
+
+	c.processCommandEvent(&cmdEvent{cmd: relabelled, addr: &net.UDPAddr{}})
+
+	switch event := (<-sub.Events).(type) {
+	case *BulbUpdated:
+		if got := event.Bulb.GetLabel(); got != "Renamed" {
+			t.Fatalf("expected Renamed, got: %s", got)
+		}
+	default:
+		t.Fatalf("expected BulbUpdated, got: %T", event)
+	}
+}
+
+func TestStateChangedCarriesTheChangeMade(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.SubscribeWith(SubscribeOptions{Capacity: 1000, Overflow: OverflowBlock})
+
+	bulb := newBulb([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+	bulb.bulbState = newBulbState(0, 0, 0, 0, 0, bulbOff, true)
+	c.bulbs = append(c.bulbs, bulb)
+
+	done := make(chan struct{})
+
+	// a caller dimming while the event loop reports power
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			c.updateBulbDim(bulb, uint16(i+1))
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		c.updateBulbPowerState(bulb.LifxAddress, uint16(i%2)+1)
+	}
+
+	<-done
+
+	for {
+		select {
+		case event := <-sub.Events:
+			change := event.(*BulbStateChanged)
+
+			if (change.Old.Dim != change.New.Dim) == (change.Old.Power != change.New.Power) {
+				t.Fatalf("expected exactly one of dim or power to change, got: %+v -> %+v", change.Old, change.New)
+			}
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
+
+func TestGetVersionSyncReturnsHardware(t *testing.T) {
+	c := NewClient()
+
+	listener := listenAsGateway(t, c)
+	defer listener.Close()
+
+	msg, err := decodeCommand(versionStateMsg())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := msg.(*versionStateCommand)
+
+	var hw HardwareInfo
+
+	errCh := startRequest(t, c, func() (err error) {
+		hw, err = c.GetVersionSync(context.Background(), newBulb(reply.Header.TargetMacAddress))
+		return err
+	})
+
+	c.processCommandEvent(&cmdEvent{cmd: reply, addr: &net.UDPAddr{}})
+
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if hw != (HardwareInfo{reply.Payload.Vendor, reply.Payload.Product, reply.Payload.Version}) {
+		t.Fatalf("expected hardware from reply, got: %+v", hw)
+	}
+}
+
+func TestSubscribeRawSkipsRequests(t *testing.T) {
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.SubscribeRaw()
+
+	raw := func(pktType uint16, source uint32) *cmdEvent {
+		cmd := newRawCommand(pktType, []byte{0x01})
+		cmd.SetSource(source)
+		return &cmdEvent{&net.UDPAddr{}, cmd.Header, cmd}
+	}
+
+	// our own discovery broadcast, a request from another client and a packet we sent
+	c.processCommandEvent(raw(PktGetPANgateway, 0))
+	c.processCommandEvent(raw(PktGetLightState, c.source+1))
+	c.processCommandEvent(raw(0x0b, c.source))
+
+	c.processCommandEvent(raw(0x0b, c.source+1))
+
+	packet := (<-sub.Events).(*RawPacket)
+
+	if packet.Header.PacketType != 0x0b || packet.Header.Source != c.source+1 {
+		t.Fatalf("expected only the unknown packet from another source, got: %+v", packet.Header)
+	}
+
+	select {
+	case event := <-sub.Events:
+		t.Fatalf("expected no further packets, got: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -2,45 +2,73 @@ package lifx
 
 import (
 	"bytes"
-	"encoding/binary"
-	"fmt"
 	"io"
+	"time"
+
+	"github.com/wolfeidau/lifx/protocol"
 )
 
 type command interface {
 	SetSiteAddr(site [6]byte)
 	SetLifxAddr(addr [6]byte)
+	SetTagAddr(tags uint64)
+	SetHeaderVersion(version HeaderVersion)
+	SetSource(source uint32)
+	SetSequence(sequence uint8)
+	SetAckRequired(ack bool)
+	GetHeader() *Header
 	WriteTo(wr io.Writer) (int, error)
 }
 
-func decodeCommand(buf []byte) (command, error) {
+// the built in packet types register themselves like any other
+func init() {
+	registerBuiltinPacket(PktPANgateway, decodePANGatewayCommand)
+	registerBuiltinPacket(PktLightState, decodeLightStateCommand)
+	registerBuiltinPacket(PktAmbientLightState, decodeAmbientStateCommand)
+	registerBuiltinPacket(PktPowerState, decodePowerStateCommand)
+	registerBuiltinPacket(PktBulbLabel, decodeBulbLabelCommand)
+	registerBuiltinPacket(PktTags, decodeTagsCommand)
+	registerBuiltinPacket(PktTagLabels, decodeTagLabelsCommand)
+	registerBuiltinPacket(PktTimeState, decodeTimeStateCommand)
+	registerBuiltinPacket(PktResetSwitchState, decodeResetSwitchStateCommand)
+	registerBuiltinPacket(PktMeshInfo, decodeMeshInfoCommand)
+	registerBuiltinPacket(PktWifiInfo, decodeWifiInfoCommand)
+	registerBuiltinPacket(PktWifiState, decodeWifiStateCommand)
+	registerBuiltinPacket(PktAccessPoint, decodeAccessPointCommand)
+	registerBuiltinPacket(PktMeshFirmwareState, decodeFirmwareStateCommand)
+	registerBuiltinPacket(PktWifiFirmwareState, decodeFirmwareStateCommand)
+	registerBuiltinPacket(PktVersionState, decodeVersionStateCommand)
+	registerBuiltinPacket(PktInfoState, decodeInfoStateCommand)
+	registerBuiltinPacket(PktMcuRailVoltage, decodeMcuRailVoltageCommand)
+	registerBuiltinPacket(PktAcknowledgement, decodeAckCommand)
+}
+
+func decodeCommand(buf []byte) (interface{}, error) {
+	_, msg, err := decodePacket(buf)
+	return msg, err
+}
+
+// decode the packet along with it's header, which messages registered outside the package may not retain
+func decodePacket(buf []byte) (*Header, interface{}, error) {
 	// read and validate the packet header
 	ph, err := decodePacketHeader(buf)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	switch ph.PacketType {
-	case PktPANgateway:
-		return decodePANGatewayCommand(ph, buf[HeaderLen:])
-	case PktLightState:
-		return decodeLightStateCommand(ph, buf[HeaderLen:])
-	case PktAmbientLightState:
-		return decodeAmbientStateCommand(ph, buf[HeaderLen:])
-	case PktPowerState:
-		return decodePowerStateCommand(ph, buf[HeaderLen:])
-	case PktTags:
-		return decodeTagsCommand(ph, buf[HeaderLen:])
-	case PktTagLabels:
-		return decodeTagLabelsCommand(ph, buf[HeaderLen:])
+	if decoder := lookupPacket(ph.PacketType); decoder != nil {
+		msg, err := decoder(ph, buf[HeaderLen:])
+		return ph, msg, err
 	}
 
-	return nil, fmt.Errorf("Unrecognised type 0x%x", ph.PacketType)
+	// hand anything else over as is so it can be delivered to raw subscribers
+	msg, err := decodeRawCommand(ph, buf[HeaderLen:])
+	return ph, msg, err
 }
 
 type commandPacket struct {
-	Header *packetHeader
+	Header *Header
 }
 
 func (c *commandPacket) SetSiteAddr(site [6]byte) {
@@ -51,10 +79,89 @@ func (c *commandPacket) SetLifxAddr(addr [6]byte) {
 	c.Header.TargetMacAddress = addr
 }
 
+func (c *commandPacket) SetTagAddr(tags uint64) {
+	c.Header.Tags = tags
+}
+
+func (c *commandPacket) SetHeaderVersion(version HeaderVersion) {
+	c.Header.Version = version
+}
+
+func (c *commandPacket) SetSource(source uint32) {
+	c.Header.Source = source
+}
+
+func (c *commandPacket) SetSequence(sequence uint8) {
+	c.Header.Sequence = sequence
+}
+
+func (c *commandPacket) SetAckRequired(ack bool) {
+	c.Header.AckRequired = ack
+}
+
+func (c *commandPacket) GetHeader() *Header {
+	return c.Header
+}
+
 func (c *commandPacket) WriteTo(wr io.Writer) (int, error) {
 	return writeHeaderOnly(c.Header, wr)
 }
 
+func (c *commandPacket) Type() uint16 {
+	return c.Header.PacketType
+}
+
+// RawCommand any packet type, the payload is left undecoded
+type rawCommand struct {
+	commandPacket
+	Payload []byte
+}
+
+func newRawCommand(packetType uint16, payload []byte) *rawCommand {
+	ph := newPacketHeader(packetType)
+	ph.Protocol = 0x1400
+
+	cmd := &rawCommand{}
+	cmd.Header = ph
+	cmd.Payload = payload
+
+	return cmd
+}
+
+func decodeRawCommand(ph *Header, payload []byte) (interface{}, error) {
+	cmd := &rawCommand{}
+	cmd.Header = ph
+
+	// the read buffer is reused so take a copy
+	cmd.Payload = append([]byte(nil), payload...)
+
+	return cmd, nil
+}
+
+func (c *rawCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndPayload(c.Header, c.Payload, wr)
+}
+
+// AckCommand 0x2d
+type ackCommand struct {
+	commandPacket
+}
+
+func decodeAckCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &ackCommand{}
+	cmd.Header = ph
+
+	return cmd, nil
+}
+
+func (c *ackCommand) MarshalBinary() ([]byte, error) {
+	return nil, nil
+}
+
+func (c *ackCommand) UnmarshalBinary(data []byte) error {
+	return nil
+}
+
 // GetPANGatewayCommand 0x02
 type getPANGatewayCommand struct {
 	commandPacket
@@ -68,24 +175,29 @@ func newGetPANGatewayCommand() *getPANGatewayCommand {
 
 type panGatewayCommand struct {
 	commandPacket
-	Payload struct {
-		Service uint8
-		Port    uint16
-	}
+	Payload protocol.PANGateway
 }
 
-func decodePANGatewayCommand(ph *packetHeader, payload []byte) (*panGatewayCommand, error) {
+func decodePANGatewayCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &panGatewayCommand{}
 
 	cmd.Header = ph
 
 	// decode payload
 	// log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *panGatewayCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *panGatewayCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // GetLightStateCommand 0x65
@@ -116,29 +228,28 @@ func newGetLightStateCommandFromBulb(lifxAddress [6]byte) *getLightStateCommand
 // LightStateCommand 0x6b
 type lightStateCommand struct {
 	commandPacket
-	Payload struct {
-		Hue        uint16
-		Saturation uint16
-		Brightness uint16
-		Kelvin     uint16
-		Dim        uint16
-		Power      uint16
-		BulbLabel  [32]byte
-		Tags       uint64
-	}
+	Payload protocol.LightState
 }
 
-func decodeLightStateCommand(ph *packetHeader, payload []byte) (*lightStateCommand, error) {
+func decodeLightStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &lightStateCommand{}
 	cmd.Header = ph
 
 	// decode payload
 	//log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *lightStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *lightStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // GetAmbientLightCommand 0x65
@@ -169,41 +280,39 @@ func newGetAmbientLightCommandFromBulb(lifxAddress [6]byte) *getAmbientLightComm
 // ambientStateCommand 0x6b
 type ambientStateCommand struct {
 	commandPacket
-	Payload struct {
-		Lux float32
-	}
+	Payload protocol.AmbientLightState
 }
 
-func decodeAmbientStateCommand(ph *packetHeader, payload []byte) (*ambientStateCommand, error) {
+func decodeAmbientStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &ambientStateCommand{}
 	cmd.Header = ph
 
 	// decode payload
 	//log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *ambientStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *ambientStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // SetLightColour 0x66
 type setLightColour struct {
 	commandPacket
-	Payload struct {
-		Stream     uint8
-		Hue        uint16
-		Saturation uint16
-		Brightness uint16
-		Kelvin     uint16
-		Dim        uint32
-	}
+	Payload protocol.SetLightColour
 }
 
 func newSetLightColour(hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) *setLightColour {
 	ph := newPacketHeader(PktSetLightColour)
 	ph.Protocol = 0x1400
-	ph.Size = 49
 
 	cmd := &setLightColour{}
 
@@ -219,15 +328,237 @@ func newSetLightColour(hue uint16, sat uint16, lum uint16, kelvin uint16, timing
 }
 
 func (c *setLightColour) WriteTo(wr io.Writer) (int, error) {
-	buf := new(bytes.Buffer)
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
 
-	err := binary.Write(buf, binary.LittleEndian, &c.Payload)
+// SetWaveformCommand 0x67
+type setWaveformCommand struct {
+	commandPacket
+	Payload protocol.SetWaveform
+}
 
-	if err != nil {
-		return 0, err
+func newSetWaveformCommand(transient bool, hue uint16, sat uint16, lum uint16, kelvin uint16, period uint32, cycles float32, skewRatio int16, waveform uint8) *setWaveformCommand {
+	ph := newPacketHeader(PktSetWaveform)
+	ph.Protocol = 0x1400
+
+	cmd := &setWaveformCommand{}
+	cmd.Header = ph
+
+	if transient {
+		cmd.Payload.Transient = 1
 	}
+	cmd.Payload.Hue = hue
+	cmd.Payload.Saturation = sat
+	cmd.Payload.Brightness = lum
+	cmd.Payload.Kelvin = kelvin
+	cmd.Payload.Period = period
+	cmd.Payload.Cycles = cycles
+	cmd.Payload.SkewRatio = skewRatio
+	cmd.Payload.Waveform = waveform
+
+	return cmd
+}
+
+func (c *setWaveformCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// SetDimCommand 0x68 for an absolute level and 0x69 for a relative adjustment
+type setDimCommand struct {
+	commandPacket
+	Payload protocol.Message
+}
+
+func newSetDimAbsoluteCommand(level uint16, duration uint32) *setDimCommand {
+	return newSetDimCommand(&protocol.SetDimAbsolute{Dim: int16(level), Duration: duration})
+}
+
+func newSetDimRelativeCommand(delta int16, duration uint32) *setDimCommand {
+	return newSetDimCommand(&protocol.SetDimRelative{Dim: delta, Duration: duration})
+}
+
+func newSetDimCommand(payload protocol.Message) *setDimCommand {
+	ph := newPacketHeader(payload.Type())
+	ph.Protocol = 0x1400
+
+	cmd := &setDimCommand{}
+	cmd.Header = ph
+	cmd.Payload = payload
+
+	return cmd
+}
+
+func (c *setDimCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, c.Payload, wr)
+}
+
+// GetWifiInfoCommand 0x10
+type getWifiInfoCommand struct {
+	commandPacket
+}
+
+func newGetWifiInfoCommandFromBulb(lifxAddress [6]byte) *getWifiInfoCommand {
+	ph := newPacketHeader(PktGetWifiInfo)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getWifiInfoCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// WifiInfoCommand 0x11
+type wifiInfoCommand struct {
+	commandPacket
+	Payload protocol.WifiInfo
+}
+
+func decodeWifiInfoCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &wifiInfoCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
 
-	return writeHeaderAndPayload(c.Header, buf.Bytes(), wr)
+	return cmd, err
+}
+
+func (c *wifiInfoCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *wifiInfoCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetWifiStateCommand 0x12d
+type getWifiStateCommand struct {
+	commandPacket
+	Payload protocol.GetWifiState
+}
+
+func newGetWifiStateCommandFromBulb(lifxAddress [6]byte, iface uint8) *getWifiStateCommand {
+	ph := newPacketHeader(PktGetWifiState)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getWifiStateCommand{}
+	cmd.Header = ph
+	cmd.Payload.Interface = iface
+	return cmd
+}
+
+func (c *getWifiStateCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// WifiStateCommand 0x12f
+type wifiStateCommand struct {
+	commandPacket
+	Payload protocol.WifiState
+}
+
+func decodeWifiStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &wifiStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *wifiStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *wifiStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// SetWifiStateCommand 0x12e
+type setWifiStateCommand struct {
+	commandPacket
+	Payload protocol.SetWifiState
+}
+
+func newSetWifiStateCommand(iface uint8, status uint8) *setWifiStateCommand {
+	ph := newPacketHeader(PktSetWifiState)
+	ph.Protocol = 0x1400
+
+	cmd := &setWifiStateCommand{}
+	cmd.Header = ph
+	cmd.Payload.Interface = iface
+	cmd.Payload.Status = status
+
+	return cmd
+}
+
+func (c *setWifiStateCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// GetAccessPointsCommand 0x130
+type getAccessPointsCommand struct {
+	commandPacket
+}
+
+func newGetAccessPointsCommandFromBulb(lifxAddress [6]byte) *getAccessPointsCommand {
+	ph := newPacketHeader(PktGetAccessPoints)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getAccessPointsCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// SetAccessPointCommand 0x131
+type setAccessPointCommand struct {
+	commandPacket
+	Payload protocol.SetAccessPoint
+}
+
+func newSetAccessPointCommand(iface uint8, ssid [32]byte, password [64]byte, security uint8) *setAccessPointCommand {
+	ph := newPacketHeader(PktSetAccessPoint)
+	ph.Protocol = 0x1400
+
+	cmd := &setAccessPointCommand{}
+	cmd.Header = ph
+	cmd.Payload.Interface = iface
+	cmd.Payload.SSID = ssid
+	cmd.Payload.Password = password
+	cmd.Payload.SecurityProtocol = security
+
+	return cmd
+}
+
+func (c *setAccessPointCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// AccessPointCommand 0x132
+type accessPointCommand struct {
+	commandPacket
+	Payload protocol.AccessPoint
+}
+
+func decodeAccessPointCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &accessPointCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *accessPointCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *accessPointCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // GetPowerStateCommand 0x14
@@ -249,15 +580,11 @@ func newGetPowerStateCommand(site [6]byte, lifxAddress [6]byte) *getPowerStateCo
 // SetPowerStateCommand 0x15
 type setPowerStateCommand struct {
 	commandPacket
-	Payload struct {
-		OnOff uint16
-	}
+	Payload protocol.SetPowerState
 }
 
 func newSetPowerStateCommand(onoff uint16) *setPowerStateCommand {
 	ph := newPacketHeader(PktSetPowerState)
-
-	ph.Size = 38
 	ph.Protocol = 0x1400
 
 	cmd := &setPowerStateCommand{}
@@ -268,32 +595,94 @@ func newSetPowerStateCommand(onoff uint16) *setPowerStateCommand {
 }
 
 func (c *setPowerStateCommand) WriteTo(wr io.Writer) (int, error) {
-	buf := []byte{0x0, 0x0}
-
-	binary.BigEndian.PutUint16(buf, c.Payload.OnOff)
-
-	return writeHeaderAndPayload(c.Header, buf, wr)
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
 }
 
 // PowerStateCommand 0x16
 type powerStateCommand struct {
 	commandPacket
-	Payload struct {
-		OnOff uint16
-	}
+	Payload protocol.PowerState
 }
 
-func decodePowerStateCommand(ph *packetHeader, payload []byte) (*powerStateCommand, error) {
+func decodePowerStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &powerStateCommand{}
 	cmd.Header = ph
 
 	// decode payload
 	//log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *powerStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *powerStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetBulbLabelCommand 0x17
+type getBulbLabelCommand struct {
+	commandPacket
+}
+
+func newGetBulbLabelCommandFromBulb(lifxAddress [6]byte) *getBulbLabelCommand {
+	ph := newPacketHeader(PktGetBulbLabel)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getBulbLabelCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// SetBulbLabelCommand 0x18
+type setBulbLabelCommand struct {
+	commandPacket
+	Payload protocol.SetBulbLabel
+}
+
+func newSetBulbLabelCommand(label [32]byte) *setBulbLabelCommand {
+	ph := newPacketHeader(PktSetBulbLabel)
+	ph.Protocol = 0x1400
+
+	cmd := &setBulbLabelCommand{}
+	cmd.Header = ph
+	cmd.Payload.Label = label
+
+	return cmd
+}
+
+func (c *setBulbLabelCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// BulbLabelCommand 0x19
+type bulbLabelCommand struct {
+	commandPacket
+	Payload protocol.BulbLabel
+}
+
+func decodeBulbLabelCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &bulbLabelCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *bulbLabelCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *bulbLabelCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // GetTagsCommand 0x1a
@@ -310,33 +699,58 @@ func newGetTagsCommand(site [6]byte) *getTagsCommand {
 	return cmd
 }
 
+// SetTagsCommand 0x1b
+type setTagsCommand struct {
+	commandPacket
+	Payload protocol.SetTags
+}
+
+func newSetTagsCommand(tags uint64) *setTagsCommand {
+	ph := newPacketHeader(PktSetTags)
+	ph.Protocol = 0x1400
+
+	cmd := &setTagsCommand{}
+	cmd.Header = ph
+	cmd.Payload.Tags = tags
+
+	return cmd
+}
+
+func (c *setTagsCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
 // TagsCommand 0x1c
 type tagsCommand struct {
 	commandPacket
-	Payload struct {
-		Tags uint64
-	}
+	Payload protocol.Tags
 }
 
-func decodeTagsCommand(ph *packetHeader, payload []byte) (*tagsCommand, error) {
+func decodeTagsCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &tagsCommand{}
 	cmd.Header = ph
 
 	// decode payload
 	//log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *tagsCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *tagsCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
 }
 
 // GetTagLabelsCommand 0x1d
 type getTagLabelsCommand struct {
 	commandPacket
-	Payload struct {
-		Tags uint64
-	}
+	Payload protocol.GetTagLabels
 }
 
 func newGetTagLabelsCommand(site [6]byte, tags uint64) *getTagLabelsCommand {
@@ -346,34 +760,384 @@ func newGetTagLabelsCommand(site [6]byte, tags uint64) *getTagLabelsCommand {
 
 	cmd := &getTagLabelsCommand{}
 	cmd.Header = ph
-	cmd.Payload = struct{ Tags uint64 }{Tags: tags}
+	cmd.Payload.Tags = tags
+
+	return cmd
+}
+
+func (c *getTagLabelsCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// SetTagLabelsCommand 0x1e
+type setTagLabelsCommand struct {
+	commandPacket
+	Payload protocol.SetTagLabels
+}
+
+func newSetTagLabelsCommand(tags uint64, label [32]byte) *setTagLabelsCommand {
+	ph := newPacketHeader(PktSetTagLabels)
+	ph.Protocol = 0x1400
+
+	cmd := &setTagLabelsCommand{}
+	cmd.Header = ph
+	cmd.Payload.Tags = tags
+	cmd.Payload.Label = label
 
 	return cmd
 }
 
+func (c *setTagLabelsCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
 // TagLabelsCommand 0x1f
 type tagLabelsCommand struct {
 	commandPacket
-	Payload struct {
-		Tags  uint64
-		Label [32]byte
-	}
+	Payload protocol.TagLabels
 }
 
-func decodeTagLabelsCommand(ph *packetHeader, payload []byte) (*tagLabelsCommand, error) {
+func decodeTagLabelsCommand(ph *Header, payload []byte) (protocol.Message, error) {
 	cmd := &tagLabelsCommand{}
 	cmd.Header = ph
 
 	// decode payload
 	//log.Printf("payload len : %d", len(payload))
-	decodePayload(payload, &cmd.Payload)
+	err := cmd.Payload.UnmarshalBinary(payload)
 
 	//log.Printf("Command: \n %s", spew.Sdump(cmd))
 
-	return cmd, nil
+	return cmd, err
+}
+
+func (c *tagLabelsCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *tagLabelsCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetVersionCommand 0x20
+type getVersionCommand struct {
+	commandPacket
+}
+
+func newGetVersionCommandFromBulb(lifxAddress [6]byte) *getVersionCommand {
+	ph := newPacketHeader(PktGetVersion)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getVersionCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// VersionStateCommand 0x21
+type versionStateCommand struct {
+	commandPacket
+	Payload protocol.VersionState
+}
+
+func decodeVersionStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &versionStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *versionStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *versionStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetTimeCommand 0x04
+type getTimeCommand struct {
+	commandPacket
+}
+
+func newGetTimeCommandFromBulb(lifxAddress [6]byte) *getTimeCommand {
+	ph := newPacketHeader(PktGetTime)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getTimeCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// SetTimeCommand 0x05
+type setTimeCommand struct {
+	commandPacket
+	Payload protocol.SetTime
+}
+
+func newSetTimeCommand(t time.Time) *setTimeCommand {
+	ph := newPacketHeader(PktSetTime)
+	ph.Protocol = 0x1400
+
+	cmd := &setTimeCommand{}
+	cmd.Header = ph
+	cmd.Payload.Time = uint64(t.UnixNano())
+
+	return cmd
+}
+
+func (c *setTimeCommand) WriteTo(wr io.Writer) (int, error) {
+	return writeHeaderAndMessage(c.Header, &c.Payload, wr)
+}
+
+// TimeStateCommand 0x06
+type timeStateCommand struct {
+	commandPacket
+	Payload protocol.TimeState
+}
+
+func decodeTimeStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &timeStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *timeStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *timeStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetResetSwitchStateCommand 0x07
+type getResetSwitchStateCommand struct {
+	commandPacket
+}
+
+func newGetResetSwitchStateCommandFromBulb(lifxAddress [6]byte) *getResetSwitchStateCommand {
+	ph := newPacketHeader(PktGetResetSwitchState)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getResetSwitchStateCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// ResetSwitchStateCommand 0x08
+type resetSwitchStateCommand struct {
+	commandPacket
+	Payload protocol.ResetSwitchState
+}
+
+func decodeResetSwitchStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &resetSwitchStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *resetSwitchStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
 }
 
-func writeHeaderOnly(h *packetHeader, wr io.Writer) (int, error) {
+func (c *resetSwitchStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetMeshInfoCommand 0x0c
+type getMeshInfoCommand struct {
+	commandPacket
+}
+
+func newGetMeshInfoCommand(site [6]byte) *getMeshInfoCommand {
+	ph := newPacketHeader(PktGetMeshInfo)
+	ph.Protocol = 0x1400
+	ph.Site = site
+
+	cmd := &getMeshInfoCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+func newGetMeshInfoCommandFromBulb(lifxAddress [6]byte) *getMeshInfoCommand {
+	ph := newPacketHeader(PktGetMeshInfo)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getMeshInfoCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// MeshInfoCommand 0x0d
+type meshInfoCommand struct {
+	commandPacket
+	Payload protocol.MeshInfo
+}
+
+func decodeMeshInfoCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &meshInfoCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *meshInfoCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *meshInfoCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetFirmwareCommand 0x0e for the mesh and 0x12 for the wifi subsystem
+type getFirmwareCommand struct {
+	commandPacket
+}
+
+func newGetFirmwareCommandFromBulb(packetType uint16, lifxAddress [6]byte) *getFirmwareCommand {
+	ph := newPacketHeader(packetType)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getFirmwareCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// FirmwareStateCommand 0x0f for the mesh and 0x13 for the wifi subsystem
+type firmwareStateCommand struct {
+	commandPacket
+	Payload protocol.FirmwareState
+}
+
+func decodeFirmwareStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &firmwareStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *firmwareStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *firmwareStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetInfoCommand 0x22
+type getInfoCommand struct {
+	commandPacket
+}
+
+func newGetInfoCommandFromBulb(lifxAddress [6]byte) *getInfoCommand {
+	ph := newPacketHeader(PktGetInfo)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getInfoCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// InfoStateCommand 0x23
+type infoStateCommand struct {
+	commandPacket
+	Payload protocol.InfoState
+}
+
+func decodeInfoStateCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &infoStateCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *infoStateCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *infoStateCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// GetMcuRailVoltageCommand 0x24
+type getMcuRailVoltageCommand struct {
+	commandPacket
+}
+
+func newGetMcuRailVoltageCommandFromBulb(lifxAddress [6]byte) *getMcuRailVoltageCommand {
+	ph := newPacketHeader(PktGetMcuRailVoltage)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &getMcuRailVoltageCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+// McuRailVoltageCommand 0x25
+type mcuRailVoltageCommand struct {
+	commandPacket
+	Payload protocol.McuRailVoltage
+}
+
+func decodeMcuRailVoltageCommand(ph *Header, payload []byte) (protocol.Message, error) {
+	cmd := &mcuRailVoltageCommand{}
+	cmd.Header = ph
+
+	// decode payload
+	err := cmd.Payload.UnmarshalBinary(payload)
+
+	return cmd, err
+}
+
+func (c *mcuRailVoltageCommand) MarshalBinary() ([]byte, error) {
+	return c.Payload.MarshalBinary()
+}
+
+func (c *mcuRailVoltageCommand) UnmarshalBinary(data []byte) error {
+	return c.Payload.UnmarshalBinary(data)
+}
+
+// RebootCommand 0x26
+type rebootCommand struct {
+	commandPacket
+}
+
+func newRebootCommandFromBulb(lifxAddress [6]byte) *rebootCommand {
+	ph := newPacketHeader(PktReboot)
+	ph.Protocol = 0x1400
+	ph.TargetMacAddress = lifxAddress
+
+	cmd := &rebootCommand{}
+	cmd.Header = ph
+	return cmd
+}
+
+func writeHeaderOnly(h *Header, wr io.Writer) (int, error) {
 	buf := new(bytes.Buffer)
 	n, err := h.Encode(buf)
 
@@ -384,7 +1148,19 @@ func writeHeaderOnly(h *packetHeader, wr io.Writer) (int, error) {
 	return wr.Write(buf.Bytes())
 }
 
-func writeHeaderAndPayload(h *packetHeader, payload []byte, wr io.Writer) (int, error) {
+func writeHeaderAndMessage(h *Header, m protocol.Message, wr io.Writer) (int, error) {
+	payload, err := m.MarshalBinary()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return writeHeaderAndPayload(h, payload, wr)
+}
+
+func writeHeaderAndPayload(h *Header, payload []byte, wr io.Writer) (int, error) {
+	h.Size = uint16(HeaderLen + len(payload))
+
 	buf := new(bytes.Buffer)
 	n, err := h.Encode(buf)
 
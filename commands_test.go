@@ -2,8 +2,10 @@ package lifx
 
 import (
 	"bytes"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestGetPANGatewayCommandWrite(t *testing.T) {
@@ -103,3 +105,267 @@ func TestPowerStateCommandDecode(t *testing.T) {
 		t.Fatal("expected panGatewayCommand")
 	}
 }
+
+func TestVersionStateCommandDecode(t *testing.T) {
+	buf := versionStateMsg()
+
+	cmd, err := decodeCommand(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *versionStateCommand:
+		if cmd.Payload.Vendor != 1 || cmd.Payload.Product != 0x16 {
+			t.Fatalf("expected vendor 1 product 0x16, got: %d 0x%x", cmd.Payload.Vendor, cmd.Payload.Product)
+		}
+	default:
+		t.Fatal("expected versionStateCommand")
+	}
+}
+
+func TestFirmwareStateCommandDecode(t *testing.T) {
+	buf := wifiFirmwareStateMsg()
+
+	cmd, err := decodeCommand(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *firmwareStateCommand:
+		fw := newFirmwareInfo(cmd.Payload.Build, cmd.Payload.Version)
+
+		if fw.String() != "2.1" {
+			t.Fatalf("expected 2.1, got: %s", fw)
+		}
+
+		if fw.Build.Year() != 2015 {
+			t.Fatalf("expected 2015, got: %d", fw.Build.Year())
+		}
+	default:
+		t.Fatal("expected firmwareStateCommand")
+	}
+}
+
+func TestSetTimeCommandWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	now := time.Unix(1433116800, 0)
+
+	c := newSetTimeCommand(now)
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 44 {
+		t.Fatalf("expected %d, got: %d", 44, n)
+	}
+
+	// the time state response shares the same payload
+	buf.Bytes()[32] = byte(PktTimeState)
+
+	cmd, err := decodeCommand(buf.Bytes())
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *timeStateCommand:
+		if !time.Unix(0, int64(cmd.Payload.Time)).Equal(now) {
+			t.Fatalf("expected %s, got: %d", now, cmd.Payload.Time)
+		}
+	default:
+		t.Fatal("expected timeStateCommand")
+	}
+}
+
+func TestSetBulbLabelCommandWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	label, err := encodeLabel("Kitchen")
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	c := newSetBulbLabelCommand(label)
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 68 {
+		t.Fatalf("expected %d, got: %d", 68, n)
+	}
+
+	if got := decodeLabel(label); got != "Kitchen" {
+		t.Fatalf("expected Kitchen, got: %s", got)
+	}
+
+	_, err = encodeLabel("a label which is far too long for the bulb")
+
+	if err == nil {
+		t.Fatal("expected error for label longer than 32 bytes")
+	}
+}
+
+func TestSetTagLabelsCommandWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	label, _ := encodeLabel("Lounge")
+
+	c := newSetTagLabelsCommand(0x2, label)
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 76 {
+		t.Fatalf("expected %d, got: %d", 76, n)
+	}
+
+	// the tag labels response shares the same payload
+	buf.Bytes()[32] = byte(PktTagLabels)
+
+	cmd, err := decodeCommand(buf.Bytes())
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *tagLabelsCommand:
+		if cmd.Payload.Tags != 0x2 || decodeLabel(cmd.Payload.Label) != "Lounge" {
+			t.Fatalf("expected tag 2 Lounge, got: %x %s", cmd.Payload.Tags, cmd.Payload.Label)
+		}
+	default:
+		t.Fatal("expected tagLabelsCommand")
+	}
+}
+
+func TestSetWaveformCommandWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	c, err := newSetWaveformFromOptions(WaveformOptions{
+		Waveform:   WaveformSine,
+		Transient:  true,
+		Brightness: 0xffff,
+		Period:     1000,
+		Cycles:     5,
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 57 {
+		t.Fatalf("expected %d, got: %d", 57, n)
+	}
+
+	if buf.Bytes()[HeaderLen+1] != 1 || buf.Bytes()[56] != byte(WaveformSine) {
+		t.Fatalf("expected transient sine waveform, got: % x", buf.Bytes()[HeaderLen:])
+	}
+
+	_, err = newSetWaveformFromOptions(WaveformOptions{Waveform: WaveformPulse + 1})
+
+	if err == nil {
+		t.Fatal("expected error for unknown waveform")
+	}
+}
+
+func TestWifiStateCommandDecode(t *testing.T) {
+	buf := wifiStateMsg()
+
+	cmd, err := decodeCommand(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *wifiStateCommand:
+		if WifiInterface(cmd.Payload.Interface) != WifiStation || WifiStatus(cmd.Payload.Status) != WifiConnected {
+			t.Fatalf("expected station connected, got: %d %d", cmd.Payload.Interface, cmd.Payload.Status)
+		}
+
+		if ip := net.IP(cmd.Payload.IP4[:]).String(); ip != "192.168.1.10" {
+			t.Fatalf("expected 192.168.1.10, got: %s", ip)
+		}
+	default:
+		t.Fatal("expected wifiStateCommand")
+	}
+}
+
+func TestSetAccessPointCommandWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	var ssid [32]byte
+	var password [64]byte
+
+	copy(ssid[:], "home")
+	copy(password[:], "secret")
+
+	c := newSetAccessPointCommand(uint8(WifiStation), ssid, password, uint8(SecurityWPA2AESPSK))
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 134 {
+		t.Fatalf("expected %d, got: %d", 134, n)
+	}
+
+	if buf.Bytes()[133] != byte(SecurityWPA2AESPSK) {
+		t.Fatalf("expected security %d, got: %d", SecurityWPA2AESPSK, buf.Bytes()[133])
+	}
+}
+
+func TestRawCommandRoundTrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	c := newRawCommand(0x0009, []byte{0x01, 0x02, 0x03})
+	c.SetSiteAddr([6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7})
+
+	n, err := c.WriteTo(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != HeaderLen+3 {
+		t.Fatalf("expected %d, got: %d", HeaderLen+3, n)
+	}
+
+	cmd, err := decodeCommand(buf.Bytes())
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *rawCommand:
+		if cmd.Header.PacketType != 0x0009 || !reflect.DeepEqual(cmd.Payload, []byte{0x01, 0x02, 0x03}) {
+			t.Fatalf("expected type 0x9 payload 01 02 03, got: 0x%x % x", cmd.Header.PacketType, cmd.Payload)
+		}
+	default:
+		t.Fatal("expected rawCommand")
+	}
+}
@@ -0,0 +1,230 @@
+package lifx
+
+import (
+	"fmt"
+
+	"github.com/wolfeidau/lifx/protocol"
+)
+
+// EventKind identifies the type of an Event so subscribers can filter on it
+type EventKind int
+
+const (
+	// KindBulbDiscovered a bulb was seen for the first time
+	KindBulbDiscovered EventKind = iota
+	// KindBulbStateChanged the colour, power or visibility of a bulb changed
+	KindBulbStateChanged
+	// KindBulbLost a bulb has not been seen for a while
+	KindBulbLost
+	// KindBulbUpdated the label, hardware, firmware or info of a bulb was refreshed
+	KindBulbUpdated
+	// KindBulbRebooted the uptime of a bulb went backwards
+	KindBulbRebooted
+	// KindGatewayDiscovered a gateway was seen for the first time
+	KindGatewayDiscovered
+	// KindGatewayLost a gateway has not been seen for a while
+	KindGatewayLost
+	// KindSensorReading a bulb reported it's ambient light level
+	KindSensorReading
+	// KindTime a bulb reported it's clock
+	KindTime
+	// KindRailVoltage a bulb reported it's MCU rail voltage
+	KindRailVoltage
+	// KindResetSwitch the reset switch of a bulb changed position
+	KindResetSwitch
+	// KindAccessPoint a bulb found a wifi network while scanning
+	KindAccessPoint
+	// KindWifiInfo a bulb reported it's wifi signal and traffic
+	KindWifiInfo
+	// KindWifiState a bulb reported the state of a wifi interface
+	KindWifiState
+	// KindRawPacket a packet the client has no decoder for
+	KindRawPacket
+	// KindMessage a packet decoded by a type registered with RegisterPacket
+	KindMessage
+)
+
+var eventKindStrings = map[EventKind]string{
+	KindBulbDiscovered:    "BulbDiscovered",
+	KindBulbStateChanged:  "BulbStateChanged",
+	KindBulbLost:          "BulbLost",
+	KindBulbUpdated:       "BulbUpdated",
+	KindBulbRebooted:      "BulbRebooted",
+	KindGatewayDiscovered: "GatewayDiscovered",
+	KindGatewayLost:       "GatewayLost",
+	KindSensorReading:     "SensorReading",
+	KindTime:              "Time",
+	KindRailVoltage:       "RailVoltage",
+	KindResetSwitch:       "ResetSwitch",
+	KindAccessPoint:       "AccessPoint",
+	KindWifiInfo:          "WifiInfo",
+	KindWifiState:         "WifiState",
+	KindRawPacket:         "RawPacket",
+	KindMessage:           "Message",
+}
+
+func (k EventKind) String() string {
+	if s, ok := eventKindStrings[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is delivered to subscribers, type switch on it or check it's Kind
+type Event interface {
+	Kind() EventKind
+
+	// GetLifxAddress returns the unique lifx address of the bulb or gateway the event is about
+	GetLifxAddress() string
+}
+
+// BulbDiscovered is emitted to subscribers the first time a bulb is seen
+type BulbDiscovered struct {
+	Bulb *Bulb
+}
+
+// BulbStateChanged is emitted to subscribers when the state of a bulb changes
+type BulbStateChanged struct {
+	Bulb *Bulb
+	Old  BulbState
+	New  BulbState
+}
+
+// BulbLost is emitted to subscribers when a bulb has not been seen for a while,
+// a BulbStateChanged follows if it comes back
+type BulbLost struct {
+	Bulb *Bulb
+}
+
+// BulbUpdated is emitted to subscribers when the label, hardware, firmware or info of a bulb is refreshed
+type BulbUpdated struct {
+	Bulb *Bulb
+}
+
+// GatewayDiscovered is emitted to subscribers the first time a gateway is seen
+type GatewayDiscovered struct {
+	Gateway *Gateway
+}
+
+// GatewayLost is emitted to subscribers when a gateway has not been seen for a while
+type GatewayLost struct {
+	Gateway *Gateway
+}
+
+// MessageReceived is emitted to subscribers with packets decoded by a type registered with RegisterPacket
+type MessageReceived struct {
+	Header  *Header // the header of the packet, identifying the bulb which sent it
+	Message protocol.Message
+}
+
+// Kind returns KindBulbDiscovered
+func (e *BulbDiscovered) Kind() EventKind { return KindBulbDiscovered }
+
+// GetLifxAddress returns the unique lifx address of the bulb
+func (e *BulbDiscovered) GetLifxAddress() string { return e.Bulb.GetLifxAddress() }
+
+// Kind returns KindBulbStateChanged
+func (e *BulbStateChanged) Kind() EventKind { return KindBulbStateChanged }
+
+// GetLifxAddress returns the unique lifx address of the bulb
+func (e *BulbStateChanged) GetLifxAddress() string { return e.Bulb.GetLifxAddress() }
+
+// Kind returns KindBulbLost
+func (e *BulbLost) Kind() EventKind { return KindBulbLost }
+
+// GetLifxAddress returns the unique lifx address of the bulb
+func (e *BulbLost) GetLifxAddress() string { return e.Bulb.GetLifxAddress() }
+
+// Kind returns KindBulbUpdated
+func (e *BulbUpdated) Kind() EventKind { return KindBulbUpdated }
+
+// GetLifxAddress returns the unique lifx address of the bulb
+func (e *BulbUpdated) GetLifxAddress() string { return e.Bulb.GetLifxAddress() }
+
+// Kind returns KindBulbRebooted
+func (e *BulbRebooted) Kind() EventKind { return KindBulbRebooted }
+
+// GetLifxAddress returns the unique lifx address of the bulb
+func (e *BulbRebooted) GetLifxAddress() string { return e.Bulb.GetLifxAddress() }
+
+// Kind returns KindGatewayDiscovered
+func (e *GatewayDiscovered) Kind() EventKind { return KindGatewayDiscovered }
+
+// GetLifxAddress returns the unique lifx address of the gateway
+func (e *GatewayDiscovered) GetLifxAddress() string { return e.Gateway.GetLifxAddress() }
+
+// Kind returns KindGatewayLost
+func (e *GatewayLost) Kind() EventKind { return KindGatewayLost }
+
+// GetLifxAddress returns the unique lifx address of the gateway
+func (e *GatewayLost) GetLifxAddress() string { return e.Gateway.GetLifxAddress() }
+
+// Kind returns KindSensorReading
+func (l *SensorReading) Kind() EventKind { return KindSensorReading }
+
+// Kind returns KindTime
+func (t *TimeState) Kind() EventKind { return KindTime }
+
+// Kind returns KindRailVoltage
+func (m *McuRailVoltage) Kind() EventKind { return KindRailVoltage }
+
+// Kind returns KindResetSwitch
+func (r *ResetSwitchState) Kind() EventKind { return KindResetSwitch }
+
+// Kind returns KindAccessPoint
+func (a *AccessPoint) Kind() EventKind { return KindAccessPoint }
+
+// Kind returns KindWifiInfo
+func (w *WifiInfo) Kind() EventKind { return KindWifiInfo }
+
+// Kind returns KindWifiState
+func (w *WifiState) Kind() EventKind { return KindWifiState }
+
+// Kind returns KindRawPacket
+func (r *RawPacket) Kind() EventKind { return KindRawPacket }
+
+// Kind returns KindMessage
+func (e *MessageReceived) Kind() EventKind { return KindMessage }
+
+// GetLifxAddress returns the unique lifx address of the bulb which sent the packet
+func (e *MessageReceived) GetLifxAddress() string {
+	if e.Header == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", e.Header.TargetMacAddress)
+}
+
+// Filter decides if a subscriber receives an event, bulb is the known bulb the event
+// is about or nil if there isn't one
+type Filter func(event Event, bulb *Bulb) bool
+
+// FilterKind passes events of the given kinds
+func FilterKind(kinds ...EventKind) Filter {
+	return func(event Event, bulb *Bulb) bool {
+		for _, kind := range kinds {
+			if event.Kind() == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterBulb passes events about the bulbs with the given lifx addresses, as returned by Bulb.GetLifxAddress
+func FilterBulb(lifxAddresses ...string) Filter {
+	return func(event Event, bulb *Bulb) bool {
+		for _, lifxAddress := range lifxAddresses {
+			if event.GetLifxAddress() == lifxAddress {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterTag passes events about bulbs carrying any of the tags
+func FilterTag(tags uint64) Filter {
+	return func(event Event, bulb *Bulb) bool {
+		return bulb != nil && bulb.GetTags()&tags != 0
+	}
+}
@@ -21,6 +21,7 @@ func buildHandler(lifxAddress string) lifx.StateHandler {
 
 func realMain() int {
 	c := lifx.NewClient()
+	defer c.Close()
 
 	err := c.StartDiscovery()
 
@@ -36,13 +37,17 @@ func realMain() int {
 			event := <-sub.Events
 
 			switch event := event.(type) {
-			case *lifx.Gateway:
-				log.Printf("Gateway Update %s", event.GetLifxAddress())
-			case *lifx.Bulb:
-				log.Printf("Bulb Update %s", event.GetLifxAddress())
-				log.Printf(spew.Sprintf("%+v", event))
-				event.SetStateHandler(buildHandler(event.GetLifxAddress()))
-			case *lifx.LightSensorState:
+			case *lifx.GatewayDiscovered:
+				log.Printf("Gateway Discovered %s", event.GetLifxAddress())
+			case *lifx.GatewayLost:
+				log.Printf("Gateway Lost %s", event.GetLifxAddress())
+			case *lifx.BulbDiscovered:
+				log.Printf("Bulb Discovered %s", event.GetLifxAddress())
+				log.Printf(spew.Sprintf("%+v", event.Bulb))
+				event.Bulb.SetStateHandler(buildHandler(event.GetLifxAddress()))
+			case *lifx.BulbStateChanged:
+				log.Printf("Bulb State Changed %s %+v -> %+v", event.GetLifxAddress(), event.Old, event.New)
+			case *lifx.SensorReading:
 				log.Printf("Light Sensor Update %s %f", event.GetLifxAddress(), event.Lux)
 			default:
 				log.Printf("Event %+v", event)
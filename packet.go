@@ -1,94 +1,145 @@
 package lifx
 
 import (
-	"bytes"
-	"encoding/binary"
-	"io"
-	"log"
+	"github.com/wolfeidau/lifx/protocol"
 )
 
+// the packet types and header layouts are defined by the protocol package
 const (
-	HeaderLen = 36
+	HeaderLen = protocol.HeaderLen
 
-	PktGetPANgateway uint16 = 0x0002
-	PktPANgateway    uint16 = 0x0003
+	PktGetPANgateway = protocol.PktGetPANgateway
+	PktPANgateway    = protocol.PktPANgateway
 
-	PktGetTime   uint16 = 0x0004
-	PktSetTime   uint16 = 0x0005
-	PktTimeState uint16 = 0x0006
+	PktGetTime   = protocol.PktGetTime
+	PktSetTime   = protocol.PktSetTime
+	PktTimeState = protocol.PktTimeState
 
-	PktGetPowerState uint16 = 0x0014
-	PktSetPowerState uint16 = 0x0015
-	PktPowerState    uint16 = 0x0016
+	PktGetResetSwitchState = protocol.PktGetResetSwitchState
+	PktResetSwitchState    = protocol.PktResetSwitchState
 
-	PktGetLightState  uint16 = 0x0065
-	PktSetLightColour uint16 = 0x0066
-	PktLightState     uint16 = 0x006b
+	PktGetMeshInfo = protocol.PktGetMeshInfo
+	PktMeshInfo    = protocol.PktMeshInfo
 
-	PktGetAmbientLight   uint16 = 0x0191
-	PktAmbientLightState uint16 = 0x0192
+	PktGetMeshFirmware   = protocol.PktGetMeshFirmware
+	PktMeshFirmwareState = protocol.PktMeshFirmwareState
 
-	PktGetTags uint16 = 0x001a
-	PktSetTags uint16 = 0x001b
-	PktTags    uint16 = 0x001c
+	PktGetWifiInfo = protocol.PktGetWifiInfo
+	PktWifiInfo    = protocol.PktWifiInfo
 
-	PktGetTagLabels uint16 = 0x001d
-	PktSetTagLabels uint16 = 0x001e
-	PktTagLabels    uint16 = 0x001f
+	PktGetWifiFirmware   = protocol.PktGetWifiFirmware
+	PktWifiFirmwareState = protocol.PktWifiFirmwareState
+
+	PktAcknowledgement = protocol.PktAcknowledgement
+
+	PktGetPowerState = protocol.PktGetPowerState
+	PktSetPowerState = protocol.PktSetPowerState
+	PktPowerState    = protocol.PktPowerState
+
+	PktGetVersion   = protocol.PktGetVersion
+	PktVersionState = protocol.PktVersionState
+
+	PktGetInfo   = protocol.PktGetInfo
+	PktInfoState = protocol.PktInfoState
+
+	PktGetMcuRailVoltage = protocol.PktGetMcuRailVoltage
+	PktMcuRailVoltage    = protocol.PktMcuRailVoltage
+	PktReboot            = protocol.PktReboot
+
+	PktGetLightState  = protocol.PktGetLightState
+	PktSetLightColour = protocol.PktSetLightColour
+	PktSetWaveform    = protocol.PktSetWaveform
+	PktSetDimAbsolute = protocol.PktSetDimAbsolute
+	PktSetDimRelative = protocol.PktSetDimRelative
+	PktLightState     = protocol.PktLightState
+
+	PktGetWifiState = protocol.PktGetWifiState
+	PktSetWifiState = protocol.PktSetWifiState
+	PktWifiState    = protocol.PktWifiState
+
+	PktGetAccessPoints = protocol.PktGetAccessPoints
+	PktSetAccessPoint  = protocol.PktSetAccessPoint
+	PktAccessPoint     = protocol.PktAccessPoint
+
+	PktGetAmbientLight   = protocol.PktGetAmbientLight
+	PktAmbientLightState = protocol.PktAmbientLightState
+
+	PktGetBulbLabel = protocol.PktGetBulbLabel
+	PktSetBulbLabel = protocol.PktSetBulbLabel
+	PktBulbLabel    = protocol.PktBulbLabel
+
+	PktGetTags = protocol.PktGetTags
+	PktSetTags = protocol.PktSetTags
+	PktTags    = protocol.PktTags
+
+	PktGetTagLabels = protocol.PktGetTagLabels
+	PktSetTagLabels = protocol.PktSetTagLabels
+	PktTagLabels    = protocol.PktTagLabels
 )
 
-type packetHeader struct {
-	Size             uint16
-	Protocol         uint16
-	Reserved1        uint32
-	TargetMacAddress [6]byte
-	Reserved2        uint16
-	Site             [6]byte
-	Reserved3        uint16
-	Timestamp        uint64
-	PacketType       uint16
-	Reserved4        uint16
+// the packet types clients send to bulbs, these are never of interest to raw subscribers
+var requestPackets = map[uint16]bool{
+	PktGetPANgateway:       true,
+	PktGetTime:             true,
+	PktSetTime:             true,
+	PktGetResetSwitchState: true,
+	PktGetMeshInfo:         true,
+	PktGetMeshFirmware:     true,
+	PktGetWifiInfo:         true,
+	PktGetWifiFirmware:     true,
+	PktGetPowerState:       true,
+	PktSetPowerState:       true,
+	PktGetVersion:          true,
+	PktGetInfo:             true,
+	PktGetMcuRailVoltage:   true,
+	PktReboot:              true,
+	PktGetLightState:       true,
+	PktSetLightColour:      true,
+	PktSetWaveform:         true,
+	PktSetDimAbsolute:      true,
+	PktSetDimRelative:      true,
+	PktGetWifiState:        true,
+	PktSetWifiState:        true,
+	PktGetAccessPoints:     true,
+	PktSetAccessPoint:      true,
+	PktGetAmbientLight:     true,
+	PktGetBulbLabel:        true,
+	PktSetBulbLabel:        true,
+	PktGetTags:             true,
+	PktSetTags:             true,
+	PktGetTagLabels:        true,
+	PktSetTagLabels:        true,
 }
 
-func newPacketHeader(packetType uint16) *packetHeader {
-	p := &packetHeader{}
+// HeaderVersion identifies which packet header layout a device speaks
+type HeaderVersion = protocol.HeaderVersion
+
+const (
+	// LegacyHeader is the original layout which carries the mesh site address
+	LegacyHeader = protocol.LegacyHeader
+
+	// FrameHeader is the LAN protocol v2 layout made up of a frame, frame address and protocol header
+	FrameHeader = protocol.FrameHeader
+)
+
+// Header is the decoded form of either header layout
+type Header = protocol.Header
+
+func newPacketHeader(packetType uint16) *Header {
+	p := &Header{}
 	p.Size = 36
 	p.Protocol = 0x3400
-	p.Reserved1 = 0x0000
-	p.Reserved2 = 0x00
-	p.Reserved3 = 0x00
 	p.PacketType = packetType
-	p.Reserved4 = 0x00
 	return p
 }
 
-func decodePacketHeader(buf []byte) (*packetHeader, error) {
-	p := &packetHeader{}
-	r := bytes.NewBuffer(buf)
-	err := binary.Read(r, binary.LittleEndian, p)
+func decodePacketHeader(buf []byte) (*Header, error) {
+	p := &Header{}
+	err := p.UnmarshalBinary(buf)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return p, err
-}
-
-func (p *packetHeader) Encode(wr io.Writer) (int, error) {
-	buf := new(bytes.Buffer)
-
-	err := binary.Write(buf, binary.LittleEndian, p)
-
-	if err != nil {
-		log.Fatalf("Woops %s", err)
-	}
-
-	//log.Printf("encode % x", buf.Bytes())
-
-	return wr.Write(buf.Bytes())
-}
-
-func decodePayload(buf []byte, payload interface{}) error {
-	r := bytes.NewBuffer(buf)
-	return binary.Read(r, binary.LittleEndian, payload)
+	return p, nil
 }
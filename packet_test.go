@@ -28,6 +28,82 @@ func TestPacketEncodeGetPANgateway(t *testing.T) {
 	}
 }
 
+func TestPacketEncodeFrameHeader(t *testing.T) {
+	p := newPacketHeader(PktGetPANgateway)
+	p.Version = FrameHeader
+	p.Source = 0x12345678
+	p.Sequence = 5
+	p.ResRequired = true
+	buf := new(bytes.Buffer)
+
+	n, err := p.Encode(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != HeaderLen {
+		t.Fatalf("expected %d, got: %d", HeaderLen, n)
+	}
+	expBuf := getServiceFrameMsg()
+
+	if !reflect.DeepEqual(expBuf, buf.Bytes()) {
+		t.Fatalf("expected % x, got: % x", expBuf, buf.Bytes())
+	}
+}
+
+func TestPacketEncodeTagged(t *testing.T) {
+	p := newPacketHeader(PktSetPowerState)
+	p.Protocol = 0x1400
+	p.Tags = 0x0102
+	p.Site = [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}
+	buf := new(bytes.Buffer)
+
+	_, err := p.Encode(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	expBuf := taggedSetPowerStateMsg()
+
+	if !reflect.DeepEqual(expBuf, buf.Bytes()) {
+		t.Fatalf("expected % x, got: % x", expBuf, buf.Bytes())
+	}
+}
+
+func TestPacketDecodeHeaderVersion(t *testing.T) {
+	p, err := decodePacketHeader(panGatewayMsg())
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if p.Version != LegacyHeader {
+		t.Fatalf("expected %d, got: %d", LegacyHeader, p.Version)
+	}
+
+	p, err = decodePacketHeader(stateServiceFrameMsg())
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if p.Version != FrameHeader {
+		t.Fatalf("expected %d, got: %d", FrameHeader, p.Version)
+	}
+
+	expAddr := [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}
+
+	if !reflect.DeepEqual(expAddr, p.TargetMacAddress) {
+		t.Fatalf("expected % x, got: % x", expAddr, p.TargetMacAddress)
+	}
+
+	if p.Source != 0x12345678 || p.Sequence != 5 {
+		t.Fatalf("expected source 12345678 sequence 5, got: %x %d", p.Source, p.Sequence)
+	}
+}
+
 // func TestPacketDecodingPANgateway(t *testing.T) {
 // 	buf := panGatewayMsg()
 // 	p, err := DecodePacketHeader(buf)
@@ -60,6 +136,18 @@ func panGatewayMsg() []byte {
 	return buf
 }
 
+// Get service using the frame header
+func getServiceFrameMsg() []byte {
+	buf, _ := hex.DecodeString("240000347856341200000000000000000000000000000105000000000000000002000000")
+	return buf
+}
+
+// State service using the frame header
+func stateServiceFrameMsg() []byte {
+	buf, _ := hex.DecodeString("2900001478563412d073d50035f700000000000000000005000000000000000003000000017cdd0000")
+	return buf
+}
+
 // Get Light Status
 func getLightStatusMsg() []byte {
 	buf, _ := hex.DecodeString("24000014000000000000000000000000d073d50035f70000000000000000000065000000")
@@ -78,8 +166,32 @@ func setPowerStateMsg() []byte {
 	return buf
 }
 
+// set power state header addressed to tags 0x0102
+func taggedSetPowerStateMsg() []byte {
+	buf, _ := hex.DecodeString("24000034000000000201000000000000d073d50035f70000000000000000000015000000")
+	return buf
+}
+
 // power state
 func powerStateMsg() []byte {
 	buf, _ := hex.DecodeString("2600005400000000d073d50035f70000d073d50035f70000000000000000000016000000ffff")
 	return buf
 }
+
+// version state
+func versionStateMsg() []byte {
+	buf, _ := hex.DecodeString("3000005400000000d073d50035f70000d073d50035f70000000000000000000021000000010000001600000000000000")
+	return buf
+}
+
+// wifi firmware state
+func wifiFirmwareStateMsg() []byte {
+	buf, _ := hex.DecodeString("3800005400000000d073d50035f70000d073d50035f700000000000000000000130000000000a5f92274e313000000000000000001000200")
+	return buf
+}
+
+// wifi state
+func wifiStateMsg() []byte {
+	buf, _ := hex.DecodeString("3a00005400000000d073d50035f70000d073d50035f7000000000000000000002f0100000201c0a8010a00000000000000000000000000000000")
+	return buf
+}
@@ -0,0 +1,278 @@
+// Package protocol provides the packet header and message types spoken by
+// lifx bulbs, each of which can be encoded and decoded on it's own
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// HeaderLen the length in bytes of both header layouts
+	HeaderLen = 36
+
+	PktGetPANgateway uint16 = 0x0002
+	PktPANgateway    uint16 = 0x0003
+
+	PktGetTime   uint16 = 0x0004
+	PktSetTime   uint16 = 0x0005
+	PktTimeState uint16 = 0x0006
+
+	PktGetResetSwitchState uint16 = 0x0007
+	PktResetSwitchState    uint16 = 0x0008
+
+	PktGetMeshInfo uint16 = 0x000c
+	PktMeshInfo    uint16 = 0x000d
+
+	PktGetMeshFirmware   uint16 = 0x000e
+	PktMeshFirmwareState uint16 = 0x000f
+
+	PktGetWifiInfo uint16 = 0x0010
+	PktWifiInfo    uint16 = 0x0011
+
+	PktGetWifiFirmware   uint16 = 0x0012
+	PktWifiFirmwareState uint16 = 0x0013
+
+	PktAcknowledgement uint16 = 0x002d
+
+	PktGetPowerState uint16 = 0x0014
+	PktSetPowerState uint16 = 0x0015
+	PktPowerState    uint16 = 0x0016
+
+	PktGetVersion   uint16 = 0x0020
+	PktVersionState uint16 = 0x0021
+
+	PktGetInfo   uint16 = 0x0022
+	PktInfoState uint16 = 0x0023
+
+	PktGetMcuRailVoltage uint16 = 0x0024
+	PktMcuRailVoltage    uint16 = 0x0025
+	PktReboot            uint16 = 0x0026
+
+	PktGetLightState  uint16 = 0x0065
+	PktSetLightColour uint16 = 0x0066
+	PktSetWaveform    uint16 = 0x0067
+	PktSetDimAbsolute uint16 = 0x0068
+	PktSetDimRelative uint16 = 0x0069
+	PktLightState     uint16 = 0x006b
+
+	PktGetWifiState uint16 = 0x012d
+	PktSetWifiState uint16 = 0x012e
+	PktWifiState    uint16 = 0x012f
+
+	PktGetAccessPoints uint16 = 0x0130
+	PktSetAccessPoint  uint16 = 0x0131
+	PktAccessPoint     uint16 = 0x0132
+
+	PktGetAmbientLight   uint16 = 0x0191
+	PktAmbientLightState uint16 = 0x0192
+
+	PktGetBulbLabel uint16 = 0x0017
+	PktSetBulbLabel uint16 = 0x0018
+	PktBulbLabel    uint16 = 0x0019
+
+	PktGetTags uint16 = 0x001a
+	PktSetTags uint16 = 0x001b
+	PktTags    uint16 = 0x001c
+
+	PktGetTagLabels uint16 = 0x001d
+	PktSetTagLabels uint16 = 0x001e
+	PktTagLabels    uint16 = 0x001f
+)
+
+// HeaderVersion identifies which packet header layout a device speaks
+type HeaderVersion uint8
+
+const (
+	// LegacyHeader is the original layout which carries the mesh site address
+	LegacyHeader HeaderVersion = iota
+
+	// FrameHeader is the LAN protocol v2 layout made up of a frame, frame address and protocol header
+	FrameHeader
+)
+
+const (
+	protocolNumber  uint16 = 0x0400
+	addressableFlag uint16 = 0x1000
+	taggedFlag      uint16 = 0x2000
+
+	resRequiredFlag uint8 = 0x01
+	ackRequiredFlag uint8 = 0x02
+)
+
+// Header is the decoded form of either header layout, fields which
+// have no meaning in a layout are left zero
+type Header struct {
+	Version          HeaderVersion // the layout used on the wire
+	Size             uint16        // length of the header and payload in bytes
+	Protocol         uint16        // protocol number and addressing flags, 0x3400 or 0x1400
+	Source           uint32        // identifies the client, echoed in replies, frame layout only
+	TargetMacAddress [6]byte       // the bulb being addressed, zero for every bulb
+	Tags             uint64        // addresses every bulb carrying these tags, legacy layout only
+	Site             [6]byte       // the mesh the bulb belongs to, legacy layout only
+	AckRequired      bool          // ask for an acknowledgement, frame layout only
+	ResRequired      bool          // ask for a response, frame layout only
+	Sequence         uint8         // correlates replies with requests, frame layout only
+	Timestamp        uint64        // legacy layout only
+	PacketType       uint16        // one of the Pkt constants
+}
+
+// legacyHeader the wire format of the original header
+type legacyHeader struct {
+	Size             uint16
+	Protocol         uint16
+	Reserved1        uint32
+	TargetMacAddress [6]byte
+	Reserved2        uint16
+	Site             [6]byte
+	Reserved3        uint16
+	Timestamp        uint64
+	PacketType       uint16
+	Reserved4        uint16
+}
+
+// frameHeader the wire format of the LAN protocol v2 header
+type frameHeader struct {
+	// frame
+	Size     uint16
+	Protocol uint16 // protocol:12 addressable:1 tagged:1 origin:2
+	Source   uint32
+
+	// frame address
+	Target    [8]byte
+	Reserved1 [6]byte
+	Flags     uint8 // res_required:1 ack_required:1 reserved:6
+	Sequence  uint8
+
+	// protocol header
+	Reserved2  uint64
+	PacketType uint16
+	Reserved3  uint16
+}
+
+var emptyAddr [6]byte
+
+// MarshalBinary encodes the header using the layout given by Version
+func (p *Header) MarshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var err error
+
+	switch p.Version {
+	case FrameHeader:
+		err = binary.Write(buf, binary.LittleEndian, p.frameHeader())
+	default:
+		err = binary.Write(buf, binary.LittleEndian, p.legacyHeader())
+	}
+
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary decodes either header layout, devices speaking the frame
+// layout never fill in the site address so that is used to tell them apart
+func (p *Header) UnmarshalBinary(data []byte) error {
+	lh := &legacyHeader{}
+	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, lh)
+
+	if err != nil {
+		return err
+	}
+
+	if lh.Site != emptyAddr {
+		*p = Header{
+			Version:          LegacyHeader,
+			Size:             lh.Size,
+			Protocol:         lh.Protocol,
+			TargetMacAddress: lh.TargetMacAddress,
+			Site:             lh.Site,
+			Timestamp:        lh.Timestamp,
+			PacketType:       lh.PacketType,
+		}
+		return nil
+	}
+
+	fh := &frameHeader{}
+	err = binary.Read(bytes.NewReader(data), binary.LittleEndian, fh)
+
+	if err != nil {
+		return err
+	}
+
+	*p = Header{
+		Version:     FrameHeader,
+		Size:        fh.Size,
+		Protocol:    fh.Protocol,
+		Source:      fh.Source,
+		AckRequired: fh.Flags&ackRequiredFlag != 0,
+		ResRequired: fh.Flags&resRequiredFlag != 0,
+		Sequence:    fh.Sequence,
+		PacketType:  fh.PacketType,
+	}
+	copy(p.TargetMacAddress[:], fh.Target[:6])
+
+	return nil
+}
+
+// Encode writes the header using the layout given by Version
+func (p *Header) Encode(wr io.Writer) (int, error) {
+	buf, err := p.MarshalBinary()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return wr.Write(buf)
+}
+
+func (p *Header) legacyHeader() *legacyHeader {
+	lh := &legacyHeader{
+		Size:             p.Size,
+		Protocol:         p.Protocol,
+		TargetMacAddress: p.TargetMacAddress,
+		Site:             p.Site,
+		Timestamp:        p.Timestamp,
+		PacketType:       p.PacketType,
+	}
+
+	// tagged packets carry the tags in place of the target address
+	if p.Tags != 0 {
+		var target [8]byte
+		binary.LittleEndian.PutUint64(target[:], p.Tags)
+
+		copy(lh.TargetMacAddress[:], target[:6])
+		lh.Reserved2 = binary.LittleEndian.Uint16(target[6:])
+		lh.Protocol |= taggedFlag
+	}
+
+	return lh
+}
+
+func (p *Header) frameHeader() *frameHeader {
+	fh := &frameHeader{
+		Size:       p.Size,
+		Protocol:   p.Protocol | protocolNumber | addressableFlag,
+		Source:     p.Source,
+		Sequence:   p.Sequence,
+		PacketType: p.PacketType,
+	}
+
+	copy(fh.Target[:], p.TargetMacAddress[:])
+
+	// without a target the frame layout relies on the tagged flag to reach every device
+	if p.TargetMacAddress == emptyAddr {
+		fh.Protocol |= taggedFlag
+	} else {
+		fh.Protocol &^= taggedFlag
+	}
+
+	if p.AckRequired {
+		fh.Flags |= ackRequiredFlag
+	}
+
+	if p.ResRequired {
+		fh.Flags |= resRequiredFlag
+	}
+
+	return fh
+}
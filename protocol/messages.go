@@ -0,0 +1,790 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+)
+
+// Message a packet payload which knows it's packet type and how to encode itself
+type Message interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+
+	// Type returns the packet type carried in the header alongside the message
+	Type() uint16
+}
+
+// GetPANGateway 0x02 asks bulbs acting as a gateway to the mesh to identify themselves
+type GetPANGateway struct{}
+
+// Type returns PktGetPANgateway
+func (m *GetPANGateway) Type() uint16 { return PktGetPANgateway }
+
+// MarshalBinary encodes the payload
+func (m *GetPANGateway) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetPANGateway) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// PANGateway 0x03 a gateway and the service it offers
+type PANGateway struct {
+	Service uint8  // 1 for UDP, 2 for TCP
+	Port    uint32 // port the service listens on
+}
+
+// Type returns PktPANgateway
+func (m *PANGateway) Type() uint16 { return PktPANgateway }
+
+// MarshalBinary encodes the payload
+func (m *PANGateway) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *PANGateway) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetTime 0x04 asks a bulb for it's clock
+type GetTime struct{}
+
+// Type returns PktGetTime
+func (m *GetTime) Type() uint16 { return PktGetTime }
+
+// MarshalBinary encodes the payload
+func (m *GetTime) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetTime) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetTime 0x05 sets a bulbs clock
+type SetTime struct {
+	Time uint64 // nanoseconds since epoch
+}
+
+// Type returns PktSetTime
+func (m *SetTime) Type() uint16 { return PktSetTime }
+
+// MarshalBinary encodes the payload
+func (m *SetTime) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetTime) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// TimeState 0x06 a bulbs clock
+type TimeState struct {
+	Time uint64 // nanoseconds since epoch
+}
+
+// Type returns PktTimeState
+func (m *TimeState) Type() uint16 { return PktTimeState }
+
+// MarshalBinary encodes the payload
+func (m *TimeState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *TimeState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetResetSwitchState 0x07 asks a bulb for the position of it's reset switch
+type GetResetSwitchState struct{}
+
+// Type returns PktGetResetSwitchState
+func (m *GetResetSwitchState) Type() uint16 { return PktGetResetSwitchState }
+
+// MarshalBinary encodes the payload
+func (m *GetResetSwitchState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetResetSwitchState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// ResetSwitchState 0x08 the position of a bulbs reset switch
+type ResetSwitchState struct {
+	Position uint8 // 0 up, 1 down
+}
+
+// Type returns PktResetSwitchState
+func (m *ResetSwitchState) Type() uint16 { return PktResetSwitchState }
+
+// MarshalBinary encodes the payload
+func (m *ResetSwitchState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *ResetSwitchState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// LinkInfo the signal and traffic of a radio, shared by MeshInfo and WifiInfo
+type LinkInfo struct {
+	Signal         float32 // received signal strength in mW
+	Tx             uint32  // bytes transmitted since power on
+	Rx             uint32  // bytes received since power on
+	McuTemperature int16
+}
+
+// MarshalBinary encodes the payload
+func (m *LinkInfo) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *LinkInfo) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetMeshInfo 0x0c asks a bulb for the quality of it's mesh link
+type GetMeshInfo struct{}
+
+// Type returns PktGetMeshInfo
+func (m *GetMeshInfo) Type() uint16 { return PktGetMeshInfo }
+
+// MarshalBinary encodes the payload
+func (m *GetMeshInfo) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetMeshInfo) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// MeshInfo 0x0d the quality of a bulbs mesh link
+type MeshInfo struct {
+	LinkInfo
+}
+
+// Type returns PktMeshInfo
+func (m *MeshInfo) Type() uint16 { return PktMeshInfo }
+
+// FirmwareState the build and version of firmware, shared by MeshFirmwareState and WifiFirmwareState
+type FirmwareState struct {
+	Build   uint64 // nanoseconds since epoch
+	Install uint64 // nanoseconds since epoch
+	Version uint32 // major in the high 16 bits, minor in the low
+}
+
+// MarshalBinary encodes the payload
+func (m *FirmwareState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *FirmwareState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetMeshFirmware 0x0e asks a bulb for the firmware of it's mesh subsystem
+type GetMeshFirmware struct{}
+
+// Type returns PktGetMeshFirmware
+func (m *GetMeshFirmware) Type() uint16 { return PktGetMeshFirmware }
+
+// MarshalBinary encodes the payload
+func (m *GetMeshFirmware) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetMeshFirmware) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// MeshFirmwareState 0x0f the firmware of a bulbs mesh subsystem
+type MeshFirmwareState struct {
+	FirmwareState
+}
+
+// Type returns PktMeshFirmwareState
+func (m *MeshFirmwareState) Type() uint16 { return PktMeshFirmwareState }
+
+// GetWifiInfo 0x10 asks a bulb for the quality of it's wifi link
+type GetWifiInfo struct{}
+
+// Type returns PktGetWifiInfo
+func (m *GetWifiInfo) Type() uint16 { return PktGetWifiInfo }
+
+// MarshalBinary encodes the payload
+func (m *GetWifiInfo) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetWifiInfo) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// WifiInfo 0x11 the quality of a bulbs wifi link
+type WifiInfo struct {
+	LinkInfo
+}
+
+// Type returns PktWifiInfo
+func (m *WifiInfo) Type() uint16 { return PktWifiInfo }
+
+// GetWifiFirmware 0x12 asks a bulb for the firmware of it's wifi subsystem
+type GetWifiFirmware struct{}
+
+// Type returns PktGetWifiFirmware
+func (m *GetWifiFirmware) Type() uint16 { return PktGetWifiFirmware }
+
+// MarshalBinary encodes the payload
+func (m *GetWifiFirmware) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetWifiFirmware) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// WifiFirmwareState 0x13 the firmware of a bulbs wifi subsystem
+type WifiFirmwareState struct {
+	FirmwareState
+}
+
+// Type returns PktWifiFirmwareState
+func (m *WifiFirmwareState) Type() uint16 { return PktWifiFirmwareState }
+
+// GetPowerState 0x14 asks a bulb whether it is on
+type GetPowerState struct{}
+
+// Type returns PktGetPowerState
+func (m *GetPowerState) Type() uint16 { return PktGetPowerState }
+
+// MarshalBinary encodes the payload
+func (m *GetPowerState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetPowerState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetPowerState 0x15 turns a bulb on or off
+type SetPowerState struct {
+	OnOff uint16 // 0 off, 1 on
+}
+
+// Type returns PktSetPowerState
+func (m *SetPowerState) Type() uint16 { return PktSetPowerState }
+
+// MarshalBinary encodes the payload, unlike every other field OnOff is big endian
+func (m *SetPowerState) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, m.OnOff)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes the payload
+func (m *SetPowerState) UnmarshalBinary(data []byte) error {
+	return binary.Read(bytes.NewReader(data), binary.BigEndian, m)
+}
+
+// PowerState 0x16 whether a bulb is on
+type PowerState struct {
+	OnOff uint16 // 0 off, 0xffff on
+}
+
+// Type returns PktPowerState
+func (m *PowerState) Type() uint16 { return PktPowerState }
+
+// MarshalBinary encodes the payload
+func (m *PowerState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *PowerState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetBulbLabel 0x17 asks a bulb for it's label
+type GetBulbLabel struct{}
+
+// Type returns PktGetBulbLabel
+func (m *GetBulbLabel) Type() uint16 { return PktGetBulbLabel }
+
+// MarshalBinary encodes the payload
+func (m *GetBulbLabel) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetBulbLabel) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetBulbLabel 0x18 changes a bulbs label
+type SetBulbLabel struct {
+	Label [32]byte // UTF-8, padded with nulls
+}
+
+// Type returns PktSetBulbLabel
+func (m *SetBulbLabel) Type() uint16 { return PktSetBulbLabel }
+
+// MarshalBinary encodes the payload
+func (m *SetBulbLabel) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetBulbLabel) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// BulbLabel 0x19 a bulbs label
+type BulbLabel struct {
+	Label [32]byte // UTF-8, padded with nulls
+}
+
+// Type returns PktBulbLabel
+func (m *BulbLabel) Type() uint16 { return PktBulbLabel }
+
+// MarshalBinary encodes the payload
+func (m *BulbLabel) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *BulbLabel) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetTags 0x1a asks bulbs for the tags in use
+type GetTags struct{}
+
+// Type returns PktGetTags
+func (m *GetTags) Type() uint16 { return PktGetTags }
+
+// MarshalBinary encodes the payload
+func (m *GetTags) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetTags) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetTags 0x1b replaces the tags a bulb carries
+type SetTags struct {
+	Tags uint64 // one bit per tag
+}
+
+// Type returns PktSetTags
+func (m *SetTags) Type() uint16 { return PktSetTags }
+
+// MarshalBinary encodes the payload
+func (m *SetTags) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetTags) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// Tags 0x1c the tags a bulb carries
+type Tags struct {
+	Tags uint64 // one bit per tag
+}
+
+// Type returns PktTags
+func (m *Tags) Type() uint16 { return PktTags }
+
+// MarshalBinary encodes the payload
+func (m *Tags) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *Tags) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetTagLabels 0x1d asks bulbs for the labels of tags
+type GetTagLabels struct {
+	Tags uint64 // one bit per tag
+}
+
+// Type returns PktGetTagLabels
+func (m *GetTagLabels) Type() uint16 { return PktGetTagLabels }
+
+// MarshalBinary encodes the payload
+func (m *GetTagLabels) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetTagLabels) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetTagLabels 0x1e labels tags, an empty label deletes the tag
+type SetTagLabels struct {
+	Tags  uint64   // one bit per tag
+	Label [32]byte // UTF-8, padded with nulls
+}
+
+// Type returns PktSetTagLabels
+func (m *SetTagLabels) Type() uint16 { return PktSetTagLabels }
+
+// MarshalBinary encodes the payload
+func (m *SetTagLabels) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetTagLabels) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// TagLabels 0x1f the label of tags
+type TagLabels struct {
+	Tags  uint64   // one bit per tag
+	Label [32]byte // UTF-8, padded with nulls
+}
+
+// Type returns PktTagLabels
+func (m *TagLabels) Type() uint16 { return PktTagLabels }
+
+// MarshalBinary encodes the payload
+func (m *TagLabels) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *TagLabels) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetVersion 0x20 asks a bulb for it's hardware version
+type GetVersion struct{}
+
+// Type returns PktGetVersion
+func (m *GetVersion) Type() uint16 { return PktGetVersion }
+
+// MarshalBinary encodes the payload
+func (m *GetVersion) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetVersion) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// VersionState 0x21 the hardware of a bulb
+type VersionState struct {
+	Vendor  uint32
+	Product uint32
+	Version uint32
+}
+
+// Type returns PktVersionState
+func (m *VersionState) Type() uint16 { return PktVersionState }
+
+// MarshalBinary encodes the payload
+func (m *VersionState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *VersionState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetInfo 0x22 asks a bulb for it's clock and power history
+type GetInfo struct{}
+
+// Type returns PktGetInfo
+func (m *GetInfo) Type() uint16 { return PktGetInfo }
+
+// MarshalBinary encodes the payload
+func (m *GetInfo) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetInfo) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// InfoState 0x23 a bulbs clock and power history
+type InfoState struct {
+	Time     uint64 // nanoseconds since epoch
+	Uptime   uint64 // nanoseconds since power on
+	Downtime uint64 // nanoseconds off before the last power on
+}
+
+// Type returns PktInfoState
+func (m *InfoState) Type() uint16 { return PktInfoState }
+
+// MarshalBinary encodes the payload
+func (m *InfoState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *InfoState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetMcuRailVoltage 0x24 asks a bulb for the voltage of it's MCU supply rail
+type GetMcuRailVoltage struct{}
+
+// Type returns PktGetMcuRailVoltage
+func (m *GetMcuRailVoltage) Type() uint16 { return PktGetMcuRailVoltage }
+
+// MarshalBinary encodes the payload
+func (m *GetMcuRailVoltage) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetMcuRailVoltage) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// McuRailVoltage 0x25 the voltage of a bulbs MCU supply rail
+type McuRailVoltage struct {
+	Voltage uint32
+}
+
+// Type returns PktMcuRailVoltage
+func (m *McuRailVoltage) Type() uint16 { return PktMcuRailVoltage }
+
+// MarshalBinary encodes the payload
+func (m *McuRailVoltage) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *McuRailVoltage) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// Reboot 0x26 restarts a bulb
+type Reboot struct{}
+
+// Type returns PktReboot
+func (m *Reboot) Type() uint16 { return PktReboot }
+
+// MarshalBinary encodes the payload
+func (m *Reboot) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *Reboot) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// Acknowledgement 0x2d confirms receipt of a packet sent with AckRequired, frame layout only
+type Acknowledgement struct{}
+
+// Type returns PktAcknowledgement
+func (m *Acknowledgement) Type() uint16 { return PktAcknowledgement }
+
+// MarshalBinary encodes the payload
+func (m *Acknowledgement) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *Acknowledgement) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetLightState 0x65 asks a bulb for it's light state
+type GetLightState struct{}
+
+// Type returns PktGetLightState
+func (m *GetLightState) Type() uint16 { return PktGetLightState }
+
+// MarshalBinary encodes the payload
+func (m *GetLightState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetLightState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetLightColour 0x66 transitions a bulb to a colour
+type SetLightColour struct {
+	Stream     uint8
+	Hue        uint16
+	Saturation uint16
+	Brightness uint16
+	Kelvin     uint16
+	Dim        uint32 // the transition time in milliseconds
+}
+
+// Type returns PktSetLightColour
+func (m *SetLightColour) Type() uint16 { return PktSetLightColour }
+
+// MarshalBinary encodes the payload
+func (m *SetLightColour) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetLightColour) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetWaveform 0x67 runs a waveform effect on a bulb
+type SetWaveform struct {
+	Stream     uint8
+	Transient  uint8 // 1 returns to the original colour once the cycles complete
+	Hue        uint16
+	Saturation uint16
+	Brightness uint16
+	Kelvin     uint16
+	Period     uint32  // duration of a cycle in milliseconds
+	Cycles     float32 // number of cycles to run
+	SkewRatio  int16   // shifts the peak of each cycle, 0 is the middle
+	Waveform   uint8   // 0 saw, 1 sine, 2 half sine, 3 triangle, 4 pulse
+}
+
+// Type returns PktSetWaveform
+func (m *SetWaveform) Type() uint16 { return PktSetWaveform }
+
+// MarshalBinary encodes the payload
+func (m *SetWaveform) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetWaveform) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetDimAbsolute 0x68 sets the dim level of a bulb leaving it's colour unchanged
+type SetDimAbsolute struct {
+	Dim      int16
+	Duration uint32 // the transition time in milliseconds
+}
+
+// Type returns PktSetDimAbsolute
+func (m *SetDimAbsolute) Type() uint16 { return PktSetDimAbsolute }
+
+// MarshalBinary encodes the payload
+func (m *SetDimAbsolute) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetDimAbsolute) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetDimRelative 0x69 moves the dim level of a bulb leaving it's colour unchanged
+type SetDimRelative struct {
+	Dim      int16
+	Duration uint32 // the transition time in milliseconds
+}
+
+// Type returns PktSetDimRelative
+func (m *SetDimRelative) Type() uint16 { return PktSetDimRelative }
+
+// MarshalBinary encodes the payload
+func (m *SetDimRelative) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetDimRelative) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// LightState 0x6b the colour, power and identity of a bulb
+type LightState struct {
+	Hue        uint16
+	Saturation uint16
+	Brightness uint16
+	Kelvin     uint16
+	Dim        uint16
+	Power      uint16   // 0 off, 0xffff on
+	BulbLabel  [32]byte // UTF-8, padded with nulls
+	Tags       uint64   // one bit per tag
+}
+
+// Type returns PktLightState
+func (m *LightState) Type() uint16 { return PktLightState }
+
+// MarshalBinary encodes the payload
+func (m *LightState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *LightState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetWifiState 0x12d asks a bulb for the state of a wifi interface
+type GetWifiState struct {
+	Interface uint8 // 1 soft ap, 2 station
+}
+
+// Type returns PktGetWifiState
+func (m *GetWifiState) Type() uint16 { return PktGetWifiState }
+
+// MarshalBinary encodes the payload
+func (m *GetWifiState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetWifiState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetWifiState 0x12e changes the state of a wifi interface
+type SetWifiState struct {
+	Interface uint8 // 1 soft ap, 2 station
+	Status    uint8 // 0 connecting, 1 connected, 2 failed, 3 off
+	IP4       [4]byte
+	IP6       [16]byte
+}
+
+// Type returns PktSetWifiState
+func (m *SetWifiState) Type() uint16 { return PktSetWifiState }
+
+// MarshalBinary encodes the payload
+func (m *SetWifiState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetWifiState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// WifiState 0x12f the state of a wifi interface
+type WifiState struct {
+	Interface uint8 // 1 soft ap, 2 station
+	Status    uint8 // 0 connecting, 1 connected, 2 failed, 3 off
+	IP4       [4]byte
+	IP6       [16]byte
+}
+
+// Type returns PktWifiState
+func (m *WifiState) Type() uint16 { return PktWifiState }
+
+// MarshalBinary encodes the payload
+func (m *WifiState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *WifiState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetAccessPoints 0x130 asks a bulb to scan for access points
+type GetAccessPoints struct{}
+
+// Type returns PktGetAccessPoints
+func (m *GetAccessPoints) Type() uint16 { return PktGetAccessPoints }
+
+// MarshalBinary encodes the payload
+func (m *GetAccessPoints) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetAccessPoints) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// SetAccessPoint 0x131 joins a bulb to a wifi network
+type SetAccessPoint struct {
+	Interface        uint8    // 1 soft ap, 2 station
+	SSID             [32]byte // UTF-8, padded with nulls
+	Password         [64]byte // UTF-8, padded with nulls
+	SecurityProtocol uint8    // 1 open through to 7 WPA2 mixed PSK
+}
+
+// Type returns PktSetAccessPoint
+func (m *SetAccessPoint) Type() uint16 { return PktSetAccessPoint }
+
+// MarshalBinary encodes the payload
+func (m *SetAccessPoint) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *SetAccessPoint) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// AccessPoint 0x132 an access point visible to a bulb, one is sent for each found in a scan
+type AccessPoint struct {
+	Interface        uint8    // 1 soft ap, 2 station
+	SSID             [32]byte // UTF-8, padded with nulls
+	SecurityProtocol uint8    // 1 open through to 7 WPA2 mixed PSK
+	Strength         uint16
+	Channel          uint16
+}
+
+// Type returns PktAccessPoint
+func (m *AccessPoint) Type() uint16 { return PktAccessPoint }
+
+// MarshalBinary encodes the payload
+func (m *AccessPoint) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *AccessPoint) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// GetAmbientLight 0x191 asks a bulb for the reading of it's light sensor
+type GetAmbientLight struct{}
+
+// Type returns PktGetAmbientLight
+func (m *GetAmbientLight) Type() uint16 { return PktGetAmbientLight }
+
+// MarshalBinary encodes the payload
+func (m *GetAmbientLight) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *GetAmbientLight) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+// AmbientLightState 0x192 the reading of a bulbs light sensor
+type AmbientLightState struct {
+	Lux float32
+}
+
+// Type returns PktAmbientLightState
+func (m *AmbientLightState) Type() uint16 { return PktAmbientLightState }
+
+// MarshalBinary encodes the payload
+func (m *AmbientLightState) MarshalBinary() ([]byte, error) { return marshal(m) }
+
+// UnmarshalBinary decodes the payload
+func (m *AmbientLightState) UnmarshalBinary(data []byte) error { return unmarshal(data, m) }
+
+func marshal(m interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.LittleEndian, m)
+	return buf.Bytes(), err
+}
+
+func unmarshal(data []byte, m interface{}) error {
+	return binary.Read(bytes.NewReader(data), binary.LittleEndian, m)
+}
+
+var messages = map[uint16]func() Message{
+	PktGetPANgateway:       func() Message { return &GetPANGateway{} },
+	PktPANgateway:          func() Message { return &PANGateway{} },
+	PktGetTime:             func() Message { return &GetTime{} },
+	PktSetTime:             func() Message { return &SetTime{} },
+	PktTimeState:           func() Message { return &TimeState{} },
+	PktGetResetSwitchState: func() Message { return &GetResetSwitchState{} },
+	PktResetSwitchState:    func() Message { return &ResetSwitchState{} },
+	PktGetMeshInfo:         func() Message { return &GetMeshInfo{} },
+	PktMeshInfo:            func() Message { return &MeshInfo{} },
+	PktGetMeshFirmware:     func() Message { return &GetMeshFirmware{} },
+	PktMeshFirmwareState:   func() Message { return &MeshFirmwareState{} },
+	PktGetWifiInfo:         func() Message { return &GetWifiInfo{} },
+	PktWifiInfo:            func() Message { return &WifiInfo{} },
+	PktGetWifiFirmware:     func() Message { return &GetWifiFirmware{} },
+	PktWifiFirmwareState:   func() Message { return &WifiFirmwareState{} },
+	PktGetPowerState:       func() Message { return &GetPowerState{} },
+	PktSetPowerState:       func() Message { return &SetPowerState{} },
+	PktPowerState:          func() Message { return &PowerState{} },
+	PktGetBulbLabel:        func() Message { return &GetBulbLabel{} },
+	PktSetBulbLabel:        func() Message { return &SetBulbLabel{} },
+	PktBulbLabel:           func() Message { return &BulbLabel{} },
+	PktGetTags:             func() Message { return &GetTags{} },
+	PktSetTags:             func() Message { return &SetTags{} },
+	PktTags:                func() Message { return &Tags{} },
+	PktGetTagLabels:        func() Message { return &GetTagLabels{} },
+	PktSetTagLabels:        func() Message { return &SetTagLabels{} },
+	PktTagLabels:           func() Message { return &TagLabels{} },
+	PktGetVersion:          func() Message { return &GetVersion{} },
+	PktVersionState:        func() Message { return &VersionState{} },
+	PktGetInfo:             func() Message { return &GetInfo{} },
+	PktInfoState:           func() Message { return &InfoState{} },
+	PktGetMcuRailVoltage:   func() Message { return &GetMcuRailVoltage{} },
+	PktMcuRailVoltage:      func() Message { return &McuRailVoltage{} },
+	PktReboot:              func() Message { return &Reboot{} },
+	PktGetLightState:       func() Message { return &GetLightState{} },
+	PktSetLightColour:      func() Message { return &SetLightColour{} },
+	PktSetWaveform:         func() Message { return &SetWaveform{} },
+	PktSetDimAbsolute:      func() Message { return &SetDimAbsolute{} },
+	PktSetDimRelative:      func() Message { return &SetDimRelative{} },
+	PktLightState:          func() Message { return &LightState{} },
+	PktGetWifiState:        func() Message { return &GetWifiState{} },
+	PktSetWifiState:        func() Message { return &SetWifiState{} },
+	PktWifiState:           func() Message { return &WifiState{} },
+	PktGetAccessPoints:     func() Message { return &GetAccessPoints{} },
+	PktSetAccessPoint:      func() Message { return &SetAccessPoint{} },
+	PktAccessPoint:         func() Message { return &AccessPoint{} },
+	PktGetAmbientLight:     func() Message { return &GetAmbientLight{} },
+	PktAmbientLightState:   func() Message { return &AmbientLightState{} },
+}
+
+// NewMessage returns an empty message for a packet type, or false if the type is unknown
+func NewMessage(pktType uint16) (Message, bool) {
+	newMessage, ok := messages[pktType]
+
+	if !ok {
+		return nil, false
+	}
+
+	return newMessage(), true
+}
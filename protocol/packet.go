@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// Packet a header and the message it carries
+type Packet struct {
+	Header  Header
+	Message Message
+}
+
+// MarshalBinary encodes the header followed by the message, the size and
+// packet type of the header are filled in from the message
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	payload, err := p.Message.MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	h := p.Header
+	h.Size = uint16(HeaderLen + len(payload))
+	h.PacketType = p.Message.Type()
+
+	buf, err := h.MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, payload...), nil
+}
+
+// UnmarshalBinary decodes the header and the message it carries, packet types
+// unknown to NewMessage are an error
+func (p *Packet) UnmarshalBinary(data []byte) error {
+	err := p.Header.UnmarshalBinary(data)
+
+	if err != nil {
+		return err
+	}
+
+	m, ok := NewMessage(p.Header.PacketType)
+
+	if !ok {
+		return fmt.Errorf("Unrecognised type 0x%x", p.Header.PacketType)
+	}
+
+	err = m.UnmarshalBinary(data[HeaderLen:])
+
+	if err != nil {
+		return err
+	}
+
+	p.Message = m
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestPacketMarshalSetPowerState(t *testing.T) {
+	p := &Packet{
+		Header:  Header{Protocol: 0x1400, Site: [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7}},
+		Message: &SetPowerState{OnOff: 1},
+	}
+
+	buf, err := p.MarshalBinary()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	expBuf, _ := hex.DecodeString("26000014000000000000000000000000d073d50035f700000000000000000000150000000001")
+
+	if !reflect.DeepEqual(expBuf, buf) {
+		t.Fatalf("expected % x, got: % x", expBuf, buf)
+	}
+}
+
+func TestPacketRoundTripLightState(t *testing.T) {
+	state := &LightState{Hue: 0xcc15, Saturation: 0xffff, Brightness: 0x1f4, Power: 0xffff, Tags: 0x2}
+	copy(state.BulbLabel[:], "Kitchen")
+
+	p := &Packet{
+		Header: Header{
+			Version:          FrameHeader,
+			Source:           0x12345678,
+			TargetMacAddress: [6]byte{0xd0, 0x73, 0xd5, 0x00, 0x35, 0xf7},
+			Sequence:         7,
+		},
+		Message: state,
+	}
+
+	buf, err := p.MarshalBinary()
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(buf) != HeaderLen+52 {
+		t.Fatalf("expected %d, got: %d", HeaderLen+52, len(buf))
+	}
+
+	decoded := &Packet{}
+	err = decoded.UnmarshalBinary(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if decoded.Header.Version != FrameHeader || decoded.Header.Sequence != 7 || decoded.Header.PacketType != PktLightState {
+		t.Fatalf("expected frame header sequence 7 type 0x6b, got: %+v", decoded.Header)
+	}
+
+	if !reflect.DeepEqual(state, decoded.Message) {
+		t.Fatalf("expected %+v, got: %+v", state, decoded.Message)
+	}
+}
+
+func TestPacketUnmarshalUnknownType(t *testing.T) {
+	buf, _ := hex.DecodeString("2400003400000000d073d50035f70000d073d50035f700000000000000000000ffff0000")
+
+	err := (&Packet{}).UnmarshalBinary(buf)
+
+	if err == nil {
+		t.Fatal("expected error for unknown packet type")
+	}
+}
@@ -0,0 +1,59 @@
+package lifx
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/wolfeidau/lifx/protocol"
+)
+
+// PacketDecoder decodes the payload of a packet, the payload is only valid for
+// the duration of the call so decoders must copy anything they retain. The decoded
+// message is delivered to subscribers as is, so it can be re-encoded and sent on
+type PacketDecoder func(header *Header, payload []byte) (protocol.Message, error)
+
+var registry = struct {
+	sync.RWMutex
+	decoders map[uint16]PacketDecoder
+	builtin  map[uint16]bool
+}{decoders: make(map[uint16]PacketDecoder), builtin: make(map[uint16]bool)}
+
+// RegisterPacket adds a decoder for a packet type, a nil decoder removes it. The client
+// tracks bulbs and gateways with the packet types built into the package, so these can't
+// be replaced or removed. Packets without a decoder are delivered to subscribers of Client.SubscribeRaw
+func RegisterPacket(pktType uint16, decoder PacketDecoder) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.builtin[pktType] {
+		return fmt.Errorf("packet type 0x%x is built in", pktType)
+	}
+
+	if decoder == nil {
+		delete(registry.decoders, pktType)
+		return nil
+	}
+
+	registry.decoders[pktType] = decoder
+
+	return nil
+}
+
+// register a packet type the client depends on, once registered it's fixed
+func registerBuiltinPacket(pktType uint16, decoder PacketDecoder) {
+	if err := RegisterPacket(pktType, decoder); err != nil {
+		panic(err)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.builtin[pktType] = true
+}
+
+func lookupPacket(pktType uint16) PacketDecoder {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return registry.decoders[pktType]
+}
@@ -0,0 +1,139 @@
+package lifx
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/wolfeidau/lifx/protocol"
+)
+
+type dummyLoad struct {
+	Level uint8
+}
+
+func (m *dummyLoad) Type() uint16 { return 0x0b }
+
+func (m *dummyLoad) MarshalBinary() ([]byte, error) { return []byte{m.Level}, nil }
+
+func (m *dummyLoad) UnmarshalBinary(data []byte) error {
+	m.Level = data[0]
+	return nil
+}
+
+func TestRegisterPacketDecoder(t *testing.T) {
+	buf := powerStateMsg()
+	buf[32] = 0x0b // dummy load
+
+	cmd, err := decodeCommand(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := cmd.(*rawCommand); !ok {
+		t.Fatalf("expected rawCommand before registering, got: %T", cmd)
+	}
+
+	RegisterPacket(0x0b, func(header *Header, payload []byte) (protocol.Message, error) {
+		msg := &dummyLoad{}
+		return msg, msg.UnmarshalBinary(payload)
+	})
+	defer RegisterPacket(0x0b, nil)
+
+	cmd, err = decodeCommand(buf)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	switch cmd := cmd.(type) {
+	case *dummyLoad:
+		if cmd.Level == 0 {
+			t.Fatalf("expected dummy load on, got: %+v", cmd)
+		}
+
+		// registered messages can be re-encoded
+		payload, err := cmd.MarshalBinary()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(payload, buf[HeaderLen:HeaderLen+1]) {
+			t.Fatalf("expected %x, got: %x", buf[HeaderLen:HeaderLen+1], payload)
+		}
+	default:
+		t.Fatalf("expected dummyLoad, got: %T", cmd)
+	}
+}
+
+func TestRegisteredPacketCarriesHeaderToSubscribers(t *testing.T) {
+	RegisterPacket(0x0b, func(header *Header, payload []byte) (protocol.Message, error) {
+		return &dummyLoad{payload[0]}, nil
+	})
+	defer RegisterPacket(0x0b, nil)
+
+	buf := powerStateMsg()
+	buf[32] = 0x0b // dummy load
+
+	header, msg, err := decodePacket(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient()
+	defer c.Close()
+
+	sub := c.Subscribe(FilterBulb(fmt.Sprintf("%x", header.TargetMacAddress)))
+
+	c.processCommandEvent(&cmdEvent{&net.UDPAddr{}, header, msg})
+
+	switch event := (<-sub.Events).(type) {
+	case *MessageReceived:
+		if event.Header != header {
+			t.Fatalf("expected the packet header, got: %+v", event.Header)
+		}
+	default:
+		t.Fatalf("expected MessageReceived, got: %T", event)
+	}
+}
+
+func TestBuiltinPacketsCannotBeReplaced(t *testing.T) {
+	decoder := func(header *Header, payload []byte) (protocol.Message, error) {
+		return &dummyLoad{}, nil
+	}
+
+	if err := RegisterPacket(PktLightState, decoder); err == nil {
+		t.Fatal("expected replacing a built in packet type to fail")
+	}
+
+	if err := RegisterPacket(PktLightState, nil); err == nil {
+		t.Fatal("expected removing a built in packet type to fail")
+	}
+
+	buf := lightStatusMsg()
+
+	cmd, err := decodeCommand(buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cmd.(*lightStateCommand); !ok {
+		t.Fatalf("expected lightStateCommand, got: %T", cmd)
+	}
+
+	// built in messages can be re-encoded like any other
+	payload, err := cmd.(protocol.Message).MarshalBinary()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(payload, buf[HeaderLen:]) {
+		t.Fatalf("expected % x, got: % x", buf[HeaderLen:], payload)
+	}
+}
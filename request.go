@@ -0,0 +1,220 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultRequestTimeout how long to wait for a reply before sending a request again
+	DefaultRequestTimeout = 500 * time.Millisecond
+
+	// DefaultRequestRetries how many times a request is sent again before giving up
+	DefaultRequestRetries = 3
+)
+
+// ErrTimeout is returned by the synchronous calls when the bulb never replied
+var ErrTimeout = errors.New("lifx: request timed out")
+
+// ErrClosed is returned by commands and queries once the client is closed
+var ErrClosed = errors.New("lifx: client closed")
+
+// ErrNoGateway is returned by commands and queries when no gateway is known to carry them
+var ErrNoGateway = errors.New("lifx: no gateway known")
+
+// a request waiting on a reply from a bulb
+type pendingRequest struct {
+	lifxAddress [6]byte
+	sequence    uint8
+	replyTypes  []uint16
+	replyCh     chan command
+	confirms    func(msg command) bool // checks the state carried by a legacy reply, nil accepts any
+}
+
+// replies from the legacy header carry no sequence so are matched on the bulb, packet type and
+// the state they carry, otherwise the replies to discovery would confirm changes which never landed
+func (p *pendingRequest) matches(h *Header, msg command) bool {
+	if h.TargetMacAddress != p.lifxAddress {
+		return false
+	}
+
+	if h.Version == FrameHeader && h.Sequence != p.sequence {
+		return false
+	}
+
+	for _, t := range p.replyTypes {
+		if h.PacketType == t {
+			return h.Version == FrameHeader || t == PktAcknowledgement || p.confirms == nil || p.confirms(msg)
+		}
+	}
+
+	return false
+}
+
+// discovery requests are sent without a sequence so 0 is skipped
+func (c *Client) nextSequence() uint8 {
+	for {
+		if sequence := uint8(atomic.AddUint32(&c.sequence, 1)); sequence != 0 {
+			return sequence
+		}
+	}
+}
+
+// send a command to a bulb and wait for one of the reply types, the command is sent
+// again each time RequestTimeout passes without a reply, up to RequestRetries times
+func (c *Client) request(ctx context.Context, bulb *Bulb, cmd command, replyTypes ...uint16) (command, error) {
+	return c.requestConfirmed(ctx, bulb, cmd, nil, replyTypes...)
+}
+
+// request with a check of the state carried by replies from legacy devices
+func (c *Client) requestConfirmed(ctx context.Context, bulb *Bulb, cmd command, confirms func(msg command) bool, replyTypes ...uint16) (command, error) {
+	req := &pendingRequest{
+		lifxAddress: bulb.LifxAddress,
+		sequence:    c.nextSequence(),
+		replyTypes:  replyTypes,
+		replyCh:     make(chan command, 1),
+		confirms:    confirms,
+	}
+
+	cmd.SetSequence(req.sequence)
+
+	c.addPending(req)
+	defer c.removePending(req)
+
+	for attempt := 0; attempt <= c.RequestRetries; attempt++ {
+		err := c.sendTo(ctx, bulb, cmd)
+
+		if err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(c.RequestTimeout)
+
+		select {
+		case reply := <-req.replyCh:
+			timer.Stop()
+			return reply, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			return nil, ErrClosed
+		case <-timer.C:
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// send a command which changes the bulb and wait for it to confirm, devices speaking the
+// frame header acknowledge it while legacy devices reply with their new state, which must pass confirms
+func (c *Client) requestAck(ctx context.Context, bulb *Bulb, cmd command, stateType uint16, confirms func(msg command) bool) error {
+	cmd.SetAckRequired(true)
+
+	_, err := c.requestConfirmed(ctx, bulb, cmd, confirms, PktAcknowledgement, stateType)
+
+	return err
+}
+
+// a legacy reply confirms the power once it reports the bulb is on or off as requested
+func confirmsPower(on bool) func(msg command) bool {
+	return func(msg command) bool {
+		cmd, ok := msg.(*powerStateCommand)
+		return ok && (cmd.Payload.OnOff != bulbOff) == on
+	}
+}
+
+func (c *Client) addPending(req *pendingRequest) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	c.pending = append(c.pending, req)
+}
+
+func (c *Client) removePending(req *pendingRequest) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	for i, p := range c.pending {
+		if p == req {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// hand a reply to the first request waiting on it
+func (c *Client) resolvePending(h *Header, msg command) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	for _, p := range c.pending {
+		if p.matches(h, msg) {
+			select {
+			case p.replyCh <- msg:
+				return
+			default:
+				// already answered by a reply from another gateway
+			}
+		}
+	}
+}
+
+// GetStateSync asks the bulb for it's current state and waits for the reply
+func (c *Client) GetStateSync(ctx context.Context, bulb *Bulb) (BulbState, error) {
+	cmd := newGetLightStateCommandFromBulb(bulb.LifxAddress)
+
+	reply, err := c.request(ctx, bulb, cmd, PktLightState)
+
+	if err != nil {
+		return BulbState{}, err
+	}
+
+	state := reply.(*lightStateCommand).Payload
+
+	return *newBulbState(state.Hue, state.Saturation, state.Brightness, state.Kelvin, state.Dim, state.Power, true), nil
+}
+
+// GetVersionSync asks the bulb for it's vendor, product and hardware version and waits for the reply
+func (c *Client) GetVersionSync(ctx context.Context, bulb *Bulb) (HardwareInfo, error) {
+	cmd := newGetVersionCommandFromBulb(bulb.LifxAddress)
+
+	reply, err := c.request(ctx, bulb, cmd, PktVersionState)
+
+	if err != nil {
+		return HardwareInfo{}, err
+	}
+
+	version := reply.(*versionStateCommand).Payload
+
+	return HardwareInfo{version.Vendor, version.Product, version.Version}, nil
+}
+
+// LightOnSync turn on a bulb and wait for it to confirm
+func (c *Client) LightOnSync(ctx context.Context, bulb *Bulb) error {
+	cmd := newSetPowerStateCommand(bulbOn)
+
+	return c.requestAck(ctx, bulb, cmd, PktPowerState, confirmsPower(true))
+}
+
+// LightOffSync turn off a bulb and wait for it to confirm
+func (c *Client) LightOffSync(ctx context.Context, bulb *Bulb) error {
+	cmd := newSetPowerStateCommand(bulbOff)
+
+	return c.requestAck(ctx, bulb, cmd, PktPowerState, confirmsPower(false))
+}
+
+// LightColourSync change the color of a bulb and wait for it to confirm, legacy devices confirm
+// by reporting the new colour so a timing longer than the retries allow ends in ErrTimeout
+func (c *Client) LightColourSync(ctx context.Context, bulb *Bulb, hue uint16, sat uint16, lum uint16, kelvin uint16, timing uint32) error {
+	cmd := newSetLightColour(hue, sat, lum, kelvin, timing)
+
+	return c.requestAck(ctx, bulb, cmd, PktLightState, func(msg command) bool {
+		state, ok := msg.(*lightStateCommand)
+		return ok && state.Payload.Hue == hue && state.Payload.Saturation == sat &&
+			state.Payload.Brightness == lum && state.Payload.Kelvin == kelvin
+	})
+}
@@ -0,0 +1,244 @@
+package lifx
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscribeCapacity how many events are queued for a subscriber which is not keeping up
+const DefaultSubscribeCapacity = 64
+
+// OverflowPolicy decides what happens to an event when the queue of a subscriber is full
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest queued event to make room, the latest state is kept
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest discards the event which didn't fit
+	OverflowDropNewest
+
+	// OverflowBlock holds up the client until the subscriber makes room, a subscriber using this
+	// must keep reading or be closed otherwise discovery stalls
+	OverflowBlock
+)
+
+var overflowPolicyStrings = map[OverflowPolicy]string{
+	OverflowDropOldest: "drop oldest",
+	OverflowDropNewest: "drop newest",
+	OverflowBlock:      "block",
+}
+
+func (p OverflowPolicy) String() string {
+	if s, ok := overflowPolicyStrings[p]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// SubscribeOptions configures the queue of a subscriber
+type SubscribeOptions struct {
+	Capacity int            // how many events are queued, defaults to DefaultSubscribeCapacity
+	Overflow OverflowPolicy // what to do with events once the queue is full
+	Filters  []Filter       // every filter must pass for an event to be queued
+}
+
+// Sub subscription of changes, events are queued for each subscriber and delivered in order
+// on Events which is closed once the subscription is closed
+type Sub struct {
+	Events chan Event
+
+	client   *Client
+	capacity int
+	overflow OverflowPolicy
+	filters  []Filter
+	dropped  uint64 // accessed atomically
+
+	queue  []Event
+	closed bool
+	mutex  sync.Mutex
+	cond   *sync.Cond    // signalled as the queue changes or the subscription closes
+	exited chan struct{} // closed once the delivery goroutine has returned
+}
+
+func newSub(client *Client, opts SubscribeOptions) *Sub {
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultSubscribeCapacity
+	}
+
+	sub := &Sub{
+		Events:   make(chan Event),
+		client:   client,
+		capacity: opts.Capacity,
+		overflow: opts.Overflow,
+		filters:  opts.Filters,
+		exited:   make(chan struct{}),
+	}
+
+	sub.cond = sync.NewCond(&sub.mutex)
+
+	go sub.deliver()
+
+	return sub
+}
+
+// Dropped returns how many events were discarded as the subscriber wasn't keeping up
+func (s *Sub) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stops the subscription, events which have not been read are discarded and Events is closed
+func (s *Sub) Close() {
+	if s.client != nil {
+		s.client.Unsubscribe(s)
+		return
+	}
+
+	s.close()
+}
+
+func (s *Sub) close() {
+	s.mutex.Lock()
+
+	if s.closed {
+		s.mutex.Unlock()
+		<-s.exited
+		return
+	}
+
+	s.closed = true
+	s.queue = nil
+	s.cond.Broadcast()
+
+	s.mutex.Unlock()
+
+	// the delivery goroutine is the only sender so it closes Events on the way out
+	<-s.exited
+}
+
+func (s *Sub) accepts(event Event, bulb *Bulb) bool {
+	for _, filter := range s.filters {
+		if !filter(event, bulb) {
+			return false
+		}
+	}
+	return true
+}
+
+// queue an event for delivery, applying the overflow policy once the queue is full
+func (s *Sub) enqueue(event Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for !s.closed && len(s.queue) >= s.capacity {
+		switch s.overflow {
+		case OverflowDropNewest:
+			atomic.AddUint64(&s.dropped, 1)
+			return
+		case OverflowBlock:
+			s.cond.Wait()
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+		}
+	}
+
+	if s.closed {
+		return
+	}
+
+	s.queue = append(s.queue, event)
+	s.cond.Broadcast()
+}
+
+// hand queued events to the subscriber one at a time
+func (s *Sub) deliver() {
+	defer close(s.exited)
+	defer close(s.Events)
+
+	// wakes a send blocked on a subscriber which isn't reading once closed
+	stop := make(chan struct{})
+
+	go func() {
+		s.mutex.Lock()
+		for !s.closed {
+			s.cond.Wait()
+		}
+		s.mutex.Unlock()
+
+		close(stop)
+	}()
+
+	for {
+		s.mutex.Lock()
+
+		for !s.closed && len(s.queue) == 0 {
+			s.cond.Wait()
+		}
+
+		if s.closed {
+			s.mutex.Unlock()
+			return
+		}
+
+		event := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+
+		// there is room for a blocked sender
+		s.cond.Broadcast()
+
+		s.mutex.Unlock()
+
+		select {
+		case s.Events <- event:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// SubscribeWith listen for new bulbs or gateways like Subscribe, with control over how events
+// are queued when the subscriber isn't keeping up
+func (c *Client) SubscribeWith(opts SubscribeOptions) *Sub {
+	return c.addSub(&c.subs, opts)
+}
+
+// Unsubscribe stops delivering events to the subscriber and closes it's Events channel
+func (c *Client) Unsubscribe(sub *Sub) {
+	c.subsMutex.Lock()
+	c.subs = removeSub(c.subs, sub)
+	c.rawSubs = removeSub(c.rawSubs, sub)
+	c.subsMutex.Unlock()
+
+	sub.close()
+}
+
+func (c *Client) addSub(subs *[]*Sub, opts SubscribeOptions) *Sub {
+	sub := newSub(c, opts)
+
+	c.closeMutex.RLock()
+	defer c.closeMutex.RUnlock()
+
+	// nothing more will be delivered once closed
+	if c.closed {
+		sub.close()
+		return sub
+	}
+
+	c.subsMutex.Lock()
+	*subs = append(*subs, sub)
+	c.subsMutex.Unlock()
+
+	return sub
+}
+
+func removeSub(subs []*Sub, sub *Sub) []*Sub {
+	for i, s := range subs {
+		if s == sub {
+			return append(subs[:i:i], subs[i+1:]...)
+		}
+	}
+	return subs
+}
@@ -0,0 +1,258 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+)
+
+const (
+	maxSSIDLen     = 32
+	maxPasswordLen = 64
+)
+
+// WifiInterface identifies one of the wifi interfaces of a bulb
+type WifiInterface uint8
+
+const (
+	// WifiSoftAP the access point a bulb provides while it is being set up
+	WifiSoftAP WifiInterface = 1
+	// WifiStation the connection from a bulb to the local network
+	WifiStation WifiInterface = 2
+)
+
+func (i WifiInterface) String() string {
+	switch i {
+	case WifiSoftAP:
+		return "soft_ap"
+	case WifiStation:
+		return "station"
+	}
+	return fmt.Sprintf("WifiInterface(%d)", uint8(i))
+}
+
+// WifiStatus the connection status of a wifi interface
+type WifiStatus uint8
+
+const (
+	// WifiConnecting the interface is joining a network
+	WifiConnecting WifiStatus = iota
+	// WifiConnected the interface has joined a network
+	WifiConnected
+	// WifiFailed the interface was unable to join a network
+	WifiFailed
+	// WifiOff the interface is disabled
+	WifiOff
+)
+
+func (s WifiStatus) String() string {
+	switch s {
+	case WifiConnecting:
+		return "connecting"
+	case WifiConnected:
+		return "connected"
+	case WifiFailed:
+		return "failed"
+	case WifiOff:
+		return "off"
+	}
+	return fmt.Sprintf("WifiStatus(%d)", uint8(s))
+}
+
+// SecurityProtocol the security used by a wifi access point
+type SecurityProtocol uint8
+
+const (
+	// SecurityOpen no security
+	SecurityOpen SecurityProtocol = iota + 1
+	// SecurityWEPPSK WEP with a pre shared key
+	SecurityWEPPSK
+	// SecurityWPATKIPPSK WPA using TKIP with a pre shared key
+	SecurityWPATKIPPSK
+	// SecurityWPAAESPSK WPA using AES with a pre shared key
+	SecurityWPAAESPSK
+	// SecurityWPA2AESPSK WPA2 using AES with a pre shared key
+	SecurityWPA2AESPSK
+	// SecurityWPA2TKIPPSK WPA2 using TKIP with a pre shared key
+	SecurityWPA2TKIPPSK
+	// SecurityWPA2MixedPSK WPA2 using TKIP or AES with a pre shared key
+	SecurityWPA2MixedPSK
+)
+
+var securityProtocolStrings = map[SecurityProtocol]string{
+	SecurityOpen:         "OPEN",
+	SecurityWEPPSK:       "WEP_PSK",
+	SecurityWPATKIPPSK:   "WPA_TKIP_PSK",
+	SecurityWPAAESPSK:    "WPA_AES_PSK",
+	SecurityWPA2AESPSK:   "WPA2_AES_PSK",
+	SecurityWPA2TKIPPSK:  "WPA2_TKIP_PSK",
+	SecurityWPA2MixedPSK: "WPA2_MIXED_PSK",
+}
+
+func (s SecurityProtocol) String() string {
+	if str, ok := securityProtocolStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("SecurityProtocol(%d)", uint8(s))
+}
+
+// AccessPoint a wifi access point visible to a bulb
+type AccessPoint struct {
+	lifxAddress [6]byte // the bulb which can see the access point
+	Interface   WifiInterface
+	SSID        string
+	Security    SecurityProtocol
+	Strength    uint16
+	Channel     uint16
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which reported the access point
+func (a *AccessPoint) GetLifxAddress() string {
+	return fmt.Sprintf("%x", a.lifxAddress)
+}
+
+// WifiInfo a snapshot of the wifi diagnostics of a bulb
+type WifiInfo struct {
+	lifxAddress    [6]byte // the bulb the diagnostics are for
+	Signal         float32 // received signal strength in mW
+	Tx             uint32  // bytes transmitted since power on
+	Rx             uint32  // bytes received since power on
+	McuTemperature int16
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which we queried for wifi info
+func (w *WifiInfo) GetLifxAddress() string {
+	return fmt.Sprintf("%x", w.lifxAddress)
+}
+
+// WifiState a snapshot of the state of a bulbs wifi interface
+type WifiState struct {
+	lifxAddress [6]byte // the bulb the interface belongs to
+	Interface   WifiInterface
+	Status      WifiStatus
+	IP          net.IP
+	IP6         net.IP
+}
+
+// GetLifxAddress returns the unique lifx address of the bulb which we queried for wifi state
+func (w *WifiState) GetLifxAddress() string {
+	return fmt.Sprintf("%x", w.lifxAddress)
+}
+
+// GetWifiInfo send a notification to the bulb to emit it's wifi signal strength and traffic counters,
+// these are delivered to subscribers as a *WifiInfo
+func (c *Client) GetWifiInfo(bulb *Bulb) error {
+	return c.GetWifiInfoCtx(context.Background(), bulb)
+}
+
+// GetWifiInfoCtx is GetWifiInfo bounded by ctx
+func (c *Client) GetWifiInfoCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetWifiInfoCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetWifiState send a notification to the bulb to emit the state of it's station interface,
+// this is delivered to subscribers as a *WifiState
+func (c *Client) GetWifiState(bulb *Bulb) error {
+	return c.GetWifiStateCtx(context.Background(), bulb)
+}
+
+// GetWifiStateCtx is GetWifiState bounded by ctx
+func (c *Client) GetWifiStateCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetWifiStateCommandFromBulb(bulb.LifxAddress, uint8(WifiStation))
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// GetAccessPoints send a notification to the bulb to scan for wifi networks, each access point
+// found is delivered to subscribers as a *AccessPoint
+func (c *Client) GetAccessPoints(bulb *Bulb) error {
+	return c.GetAccessPointsCtx(context.Background(), bulb)
+}
+
+// GetAccessPointsCtx is GetAccessPoints bounded by ctx
+func (c *Client) GetAccessPointsCtx(ctx context.Context, bulb *Bulb) error {
+	cmd := newGetAccessPointsCommandFromBulb(bulb.LifxAddress)
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// SetAccessPoint tells a bulb, typically one in soft ap mode, to join the given wifi network
+func (c *Client) SetAccessPoint(bulb *Bulb, ssid string, password string, security SecurityProtocol) error {
+	return c.SetAccessPointCtx(context.Background(), bulb, ssid, password, security)
+}
+
+// SetAccessPointCtx is SetAccessPoint bounded by ctx
+func (c *Client) SetAccessPointCtx(ctx context.Context, bulb *Bulb, ssid string, password string, security SecurityProtocol) error {
+	if len(ssid) == 0 || len(ssid) > maxSSIDLen {
+		return fmt.Errorf("ssid %q must be between 1 and %d bytes", ssid, maxSSIDLen)
+	}
+
+	if len(password) > maxPasswordLen {
+		return fmt.Errorf("password is longer than %d bytes", maxPasswordLen)
+	}
+
+	if _, ok := securityProtocolStrings[security]; !ok {
+		return fmt.Errorf("unknown security protocol %d", security)
+	}
+
+	var ssidBuf [maxSSIDLen]byte
+	var passwordBuf [maxPasswordLen]byte
+
+	copy(ssidBuf[:], ssid)
+	copy(passwordBuf[:], password)
+
+	cmd := newSetAccessPointCommand(uint8(WifiStation), ssidBuf, passwordBuf, uint8(security))
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+// SetWifiState changes the status of one of the bulbs wifi interfaces, for example
+// turning off the soft ap once the bulb has joined the network
+func (c *Client) SetWifiState(bulb *Bulb, iface WifiInterface, status WifiStatus) error {
+	return c.SetWifiStateCtx(context.Background(), bulb, iface, status)
+}
+
+// SetWifiStateCtx is SetWifiState bounded by ctx
+func (c *Client) SetWifiStateCtx(ctx context.Context, bulb *Bulb, iface WifiInterface, status WifiStatus) error {
+	cmd := newSetWifiStateCommand(uint8(iface), uint8(status))
+	return c.sendTo(ctx, bulb, cmd)
+}
+
+func (c *Client) updateAccessPoint(cmd *accessPointCommand) {
+	accessPoint := &AccessPoint{
+		lifxAddress: cmd.Header.TargetMacAddress,
+		Interface:   WifiInterface(cmd.Payload.Interface),
+		SSID:        string(bytes.Trim(cmd.Payload.SSID[:], "\x00")),
+		Security:    SecurityProtocol(cmd.Payload.SecurityProtocol),
+		Strength:    cmd.Payload.Strength,
+		Channel:     cmd.Payload.Channel,
+	}
+
+	// notify subscribers
+	c.notifySubs(accessPoint)
+}
+
+func (c *Client) updateWifiInfo(cmd *wifiInfoCommand) {
+	wifiInfo := &WifiInfo{
+		lifxAddress:    cmd.Header.TargetMacAddress,
+		Signal:         cmd.Payload.Signal,
+		Tx:             cmd.Payload.Tx,
+		Rx:             cmd.Payload.Rx,
+		McuTemperature: cmd.Payload.McuTemperature,
+	}
+
+	// notify subscribers
+	c.notifySubs(wifiInfo)
+}
+
+func (c *Client) updateWifiState(cmd *wifiStateCommand) {
+	wifiState := &WifiState{
+		lifxAddress: cmd.Header.TargetMacAddress,
+		Interface:   WifiInterface(cmd.Payload.Interface),
+		Status:      WifiStatus(cmd.Payload.Status),
+		IP:          net.IP(append([]byte(nil), cmd.Payload.IP4[:]...)),
+		IP6:         net.IP(append([]byte(nil), cmd.Payload.IP6[:]...)),
+	}
+
+	// notify subscribers
+	c.notifySubs(wifiState)
+}